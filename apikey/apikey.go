@@ -0,0 +1,241 @@
+// Package apikey issues api keys for machine clients and authenticates them.
+// A key reads <prefix>_<id>_<secret>, only the sha256 of the secret is stored.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/donech/tool/xjwt"
+	"github.com/donech/tool/xlog"
+)
+
+// DefaultPrefix is the visible prefix of issued keys.
+const DefaultPrefix = "ak"
+
+var (
+	ErrNotFound          = errors.New("api key not found")
+	ErrInvalidKey        = errors.New("api key is invalid")
+	ErrExpired           = errors.New("api key is expired")
+	ErrInsufficientScope = errors.New("api key lacks the required scope")
+)
+
+// Key is the stored part of an api key.
+type Key struct {
+	ID     string   `json:"id"`
+	Prefix string   `json:"prefix"`
+	Hash   string   `json:"hash"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Subject the key acts for, it becomes the sub claim.
+	Subject string `json:"subject"`
+	// ExpiresAt zero for keys that never expire.
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// HasScope reports whether the key grants scope, a scope ending with * grants
+// every scope with that prefix.
+func (k Key) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || strings.HasSuffix(s, "*") && strings.HasPrefix(scope, strings.TrimSuffix(s, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired reports whether the key is expired at now.
+func (k Key) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// Claims returns the claims put into the context for the key.
+func (k Key) Claims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":        k.Subject,
+		"scope":      strings.Join(k.Scopes, " "),
+		"api_key_id": k.ID,
+	}
+}
+
+// IssueRequest describes a key to issue.
+type IssueRequest struct {
+	Subject string
+	Name    string
+	Scopes  []string
+	// TTL zero for a key that never expires.
+	TTL time.Duration
+}
+
+type Manager struct {
+	store         Store
+	prefix        string
+	touchInterval time.Duration
+	now           func() time.Time
+}
+
+type Option func(m *Manager)
+
+// WithPrefix sets the visible prefix of issued keys, such as sk_live.
+func WithPrefix(prefix string) Option {
+	return func(m *Manager) {
+		m.prefix = prefix
+	}
+}
+
+// WithTouchInterval sets how often the last used time of a key is written,
+// default 1m, so that a busy key does not write on every request.
+func WithTouchInterval(interval time.Duration) Option {
+	return func(m *Manager) {
+		m.touchInterval = interval
+	}
+}
+
+func NewManager(store Store, opts ...Option) *Manager {
+	m := &Manager{store: store, prefix: DefaultPrefix, touchInterval: time.Minute, now: time.Now}
+	for _, o := range opts {
+		o(m)
+	}
+	return m
+}
+
+// Issue stores a new key and returns its plaintext, which is shown once and
+// can not be recovered.
+func (m *Manager) Issue(ctx context.Context, req IssueRequest) (string, Key, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return "", Key{}, err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return "", Key{}, err
+	}
+	now := m.now()
+	key := Key{
+		ID:        id,
+		Prefix:    m.prefix,
+		Hash:      hash(secret),
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		Subject:   req.Subject,
+		CreatedAt: now,
+	}
+	if req.TTL > 0 {
+		key.ExpiresAt = now.Add(req.TTL)
+	}
+	if err := m.store.Save(ctx, key); err != nil {
+		return "", Key{}, err
+	}
+	return m.prefix + "_" + id + "_" + secret, key, nil
+}
+
+// Authenticate returns the key of plaintext, the scopes must all be granted.
+func (m *Manager) Authenticate(ctx context.Context, plaintext string, scopes ...string) (Key, error) {
+	prefix, id, secret, ok := parse(plaintext)
+	if !ok {
+		return Key{}, ErrInvalidKey
+	}
+	key, err := m.store.Get(ctx, id)
+	if err == ErrNotFound {
+		return Key{}, ErrInvalidKey
+	}
+	if err != nil {
+		return Key{}, err
+	}
+	if key.Prefix != prefix || subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hash(secret))) != 1 {
+		return Key{}, ErrInvalidKey
+	}
+	now := m.now()
+	if key.Expired(now) {
+		return Key{}, ErrExpired
+	}
+	for _, s := range scopes {
+		if !key.HasScope(s) {
+			return Key{}, ErrInsufficientScope
+		}
+	}
+	if now.Sub(key.LastUsedAt) >= m.touchInterval {
+		// the last used time is best effort, a failed write does not reject the key
+		if err := m.store.Touch(ctx, key.ID, now); err != nil {
+			xlog.S(ctx).Warnf("touch api key %s error: %s", key.ID, err)
+		} else {
+			key.LastUsedAt = now
+		}
+	}
+	return key, nil
+}
+
+// Claims authenticates plaintext and returns the claims of its key, it fits
+// xjwt.APIKeyAuthenticator for exchanging a key for a jwt token.
+func (m *Manager) Claims(ctx context.Context, plaintext string) (jwt.MapClaims, error) {
+	key, err := m.Authenticate(ctx, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return key.Claims(), nil
+}
+
+// Revoke deletes the key of id.
+func (m *Manager) Revoke(ctx context.Context, id string) error {
+	return m.store.Delete(ctx, id)
+}
+
+// List returns the keys of subject.
+func (m *Manager) List(ctx context.Context, subject string) ([]Key, error) {
+	return m.store.List(ctx, subject)
+}
+
+// parse splits <prefix>_<id>_<secret>, the prefix itself may contain _.
+func parse(plaintext string) (prefix, id, secret string, ok bool) {
+	i := strings.LastIndex(plaintext, "_")
+	if i <= 0 {
+		return "", "", "", false
+	}
+	secret = plaintext[i+1:]
+	j := strings.LastIndex(plaintext[:i], "_")
+	if j <= 0 {
+		return "", "", "", false
+	}
+	prefix, id = plaintext[:j], plaintext[j+1:i]
+	return prefix, id, secret, id != "" && secret != ""
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+type ctxKeyType string
+
+const ctxKey ctxKeyType = "apikey"
+
+// NewContext puts key into ctx, its claims go where xjwt.SetClaimsToCtx puts
+// them so that handlers read the principal the same way for any auth method.
+func NewContext(ctx context.Context, key Key) context.Context {
+	ctx = xjwt.SetClaimsToCtx(ctx, key.Claims())
+	return context.WithValue(ctx, ctxKey, key)
+}
+
+// FromContext returns the key put by NewContext.
+func FromContext(ctx context.Context) (Key, bool) {
+	key, ok := ctx.Value(ctxKey).(Key)
+	return key, ok
+}
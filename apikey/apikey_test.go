@@ -0,0 +1,136 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+
+	"github.com/donech/tool/xjwt"
+)
+
+func TestParse(t *testing.T) {
+	assert := require.New(t)
+	prefix, id, secret, ok := parse("sk_live_0123_abcd")
+	assert.True(ok)
+	assert.Equal("sk_live", prefix)
+	assert.Equal("0123", id)
+	assert.Equal("abcd", secret)
+	for _, s := range []string{"", "abcd", "_0123_abcd", "ak__abcd", "ak_0123_"} {
+		_, _, _, ok = parse(s)
+		assert.False(ok, s)
+	}
+}
+
+func TestManager(t *testing.T) {
+	testManager(t, NewMemoryStore())
+}
+
+func TestRedisStore(t *testing.T) {
+	client := goredis.NewClient(&goredis.Options{Addr: ":6379"})
+	if err := client.Ping().Err(); err != nil {
+		t.Skip("redis is not available: ", err)
+	}
+	defer client.Close()
+	testManager(t, NewRedisStore(client, "test:apikey:"))
+}
+
+func TestGormStore(t *testing.T) {
+	db, err := gorm.Open("mysql", "root:root@tcp(127.0.0.1:3306)/test?parseTime=true")
+	if err != nil {
+		t.Skip("mysql is not available: ", err)
+	}
+	defer db.Close()
+	store := NewGormStore(db, "test_api_keys")
+	require.NoError(t, store.Migrate())
+	defer db.DropTable("test_api_keys")
+	testManager(t, store)
+}
+
+func testManager(t *testing.T, store Store) {
+	assert := require.New(t)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	m := NewManager(store, WithPrefix("sk_test"))
+	m.now = func() time.Time { return now }
+
+	plaintext, key, err := m.Issue(ctx, IssueRequest{Subject: "svc-" + now.Format("150405.000"), Name: "ci", Scopes: []string{"order:*"}, TTL: time.Hour})
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(plaintext, "sk_test_"+key.ID+"_"))
+	assert.NotContains(key.Hash, strings.TrimPrefix(plaintext, "sk_test_"+key.ID+"_"))
+
+	got, err := m.Authenticate(ctx, plaintext, "order:read")
+	assert.NoError(err)
+	assert.Equal(key.Subject, got.Subject)
+	stored, err := store.Get(ctx, key.ID)
+	assert.NoError(err)
+	assert.True(stored.LastUsedAt.Equal(now))
+
+	_, err = m.Authenticate(ctx, plaintext, "user:read")
+	assert.Equal(ErrInsufficientScope, err)
+	tampered := plaintext[:len(plaintext)-1] + "0"
+	if strings.HasSuffix(plaintext, "0") {
+		tampered = plaintext[:len(plaintext)-1] + "1"
+	}
+	_, err = m.Authenticate(ctx, tampered)
+	assert.Equal(ErrInvalidKey, err)
+	_, err = m.Authenticate(ctx, "ak_"+strings.TrimPrefix(plaintext, "sk_test_"))
+	assert.Equal(ErrInvalidKey, err)
+
+	claims, err := m.Claims(ctx, plaintext)
+	assert.NoError(err)
+	assert.Equal(key.Subject, claims["sub"])
+	assert.Equal("order:*", claims["scope"])
+
+	keys, err := m.List(ctx, key.Subject)
+	assert.NoError(err)
+	assert.Len(keys, 1)
+	assert.Equal([]string{"order:*"}, keys[0].Scopes)
+
+	now = now.Add(time.Hour)
+	_, err = m.Authenticate(ctx, plaintext)
+	assert.Equal(ErrExpired, err)
+
+	assert.NoError(m.Revoke(ctx, key.ID))
+	_, err = m.Authenticate(ctx, plaintext)
+	assert.Equal(ErrInvalidKey, err)
+	keys, err = m.List(ctx, key.Subject)
+	assert.NoError(err)
+	assert.Len(keys, 0)
+}
+
+// touchFailStore fails the last used writes.
+type touchFailStore struct {
+	Store
+}
+
+func (s touchFailStore) Touch(ctx context.Context, id string, at time.Time) error {
+	return errors.New("store unavailable")
+}
+
+func TestManager_TouchFailed(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+	m := NewManager(touchFailStore{Store: NewMemoryStore()})
+	plaintext, key, err := m.Issue(ctx, IssueRequest{Subject: "svc", Scopes: []string{"order:read"}})
+	assert.NoError(err)
+	got, err := m.Authenticate(ctx, plaintext, "order:read")
+	assert.NoError(err)
+	assert.Equal(key.ID, got.ID)
+	assert.True(got.LastUsedAt.IsZero())
+}
+
+func TestNewContext(t *testing.T) {
+	assert := require.New(t)
+	ctx := NewContext(context.Background(), Key{ID: "1", Subject: "svc", Scopes: []string{"a", "b"}})
+	assert.Equal("svc", xjwt.GetClaimsFromCtx(ctx)["sub"])
+	assert.Equal("a b", xjwt.GetClaimsFromCtx(ctx)["scope"])
+	key, ok := FromContext(ctx)
+	assert.True(ok)
+	assert.Equal("1", key.ID)
+}
@@ -0,0 +1,125 @@
+package apikey
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+
+	"github.com/donech/tool/xdb"
+)
+
+// DefaultTable is the table of GormStore.
+const DefaultTable = "api_keys"
+
+// keyRecord is the row of a key, scopes are joined by spaces.
+type keyRecord struct {
+	ID         string     `gorm:"primary_key;type:varchar(32)"`
+	Prefix     string     `gorm:"type:varchar(32);not null"`
+	Hash       string     `gorm:"type:char(64);not null"`
+	Name       string     `gorm:"type:varchar(128);not null"`
+	Scopes     string     `gorm:"type:varchar(1024);not null"`
+	Subject    string     `gorm:"type:varchar(128);not null;index"`
+	ExpiresAt  *time.Time `gorm:"column:expires_at"`
+	CreatedAt  time.Time  `gorm:"column:created_at"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at"`
+}
+
+func newKeyRecord(key Key) keyRecord {
+	r := keyRecord{
+		ID:        key.ID,
+		Prefix:    key.Prefix,
+		Hash:      key.Hash,
+		Name:      key.Name,
+		Scopes:    strings.Join(key.Scopes, " "),
+		Subject:   key.Subject,
+		CreatedAt: key.CreatedAt,
+	}
+	if !key.ExpiresAt.IsZero() {
+		r.ExpiresAt = &key.ExpiresAt
+	}
+	if !key.LastUsedAt.IsZero() {
+		r.LastUsedAt = &key.LastUsedAt
+	}
+	return r
+}
+
+func (r keyRecord) key() Key {
+	key := Key{
+		ID:        r.ID,
+		Prefix:    r.Prefix,
+		Hash:      r.Hash,
+		Name:      r.Name,
+		Scopes:    strings.Fields(r.Scopes),
+		Subject:   r.Subject,
+		CreatedAt: r.CreatedAt,
+	}
+	if r.ExpiresAt != nil {
+		key.ExpiresAt = *r.ExpiresAt
+	}
+	if r.LastUsedAt != nil {
+		key.LastUsedAt = *r.LastUsedAt
+	}
+	return key
+}
+
+// NewGormStore keeps keys in table of db, default DefaultTable, see Migrate.
+func NewGormStore(db *gorm.DB, table string) *GormStore {
+	if table == "" {
+		table = DefaultTable
+	}
+	return &GormStore{db: db, table: table}
+}
+
+type GormStore struct {
+	db    *gorm.DB
+	table string
+}
+
+func (s *GormStore) scope(ctx context.Context) *gorm.DB {
+	return xdb.Trace(ctx, s.db).Table(s.table)
+}
+
+// Migrate creates the table of the store.
+func (s *GormStore) Migrate() error {
+	return errors.WithStack(s.db.Table(s.table).AutoMigrate(&keyRecord{}).Error)
+}
+
+func (s *GormStore) Save(ctx context.Context, key Key) error {
+	r := newKeyRecord(key)
+	return errors.WithStack(s.scope(ctx).Save(&r).Error)
+}
+
+func (s *GormStore) Get(ctx context.Context, id string) (Key, error) {
+	r := keyRecord{}
+	err := s.scope(ctx).Where("id = ?", id).First(&r).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return Key{}, ErrNotFound
+	}
+	if err != nil {
+		return Key{}, errors.WithStack(err)
+	}
+	return r.key(), nil
+}
+
+func (s *GormStore) Delete(ctx context.Context, id string) error {
+	return errors.WithStack(s.scope(ctx).Where("id = ?", id).Delete(&keyRecord{}).Error)
+}
+
+func (s *GormStore) Touch(ctx context.Context, id string, at time.Time) error {
+	return errors.WithStack(s.scope(ctx).Where("id = ?", id).UpdateColumn("last_used_at", at).Error)
+}
+
+func (s *GormStore) List(ctx context.Context, subject string) ([]Key, error) {
+	records := make([]keyRecord, 0)
+	if err := s.scope(ctx).Where("subject = ?", subject).Order("created_at").Find(&records).Error; err != nil {
+		return nil, errors.WithStack(err)
+	}
+	keys := make([]Key, 0, len(records))
+	for _, r := range records {
+		keys = append(keys, r.key())
+	}
+	return keys, nil
+}
@@ -0,0 +1,118 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+)
+
+var defaultKeyPrefix = "apikey:"
+
+// NewRedisStore keeps keys in redis hashes, a key is dropped by redis once it
+// expires.
+func NewRedisStore(client *goredis.Client, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = defaultKeyPrefix
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+type RedisStore struct {
+	client *goredis.Client
+	prefix string
+}
+
+func (s *RedisStore) keyName(id string) string {
+	return s.prefix + "key:" + id
+}
+
+func (s *RedisStore) subjectName(subject string) string {
+	return s.prefix + "sub:" + subject
+}
+
+func (s *RedisStore) Save(ctx context.Context, key Key) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	pipe := s.client.WithContext(ctx).TxPipeline()
+	pipe.HSet(s.keyName(key.ID), "key", data)
+	if !key.ExpiresAt.IsZero() {
+		pipe.ExpireAt(s.keyName(key.ID), key.ExpiresAt)
+	}
+	pipe.SAdd(s.subjectName(key.Subject), key.ID)
+	_, err = pipe.Exec()
+	return err
+}
+
+func (s *RedisStore) Get(ctx context.Context, id string) (Key, error) {
+	fields, err := s.client.WithContext(ctx).HGetAll(s.keyName(id)).Result()
+	if err != nil {
+		return Key{}, err
+	}
+	if fields["key"] == "" {
+		return Key{}, ErrNotFound
+	}
+	key := Key{}
+	if err := json.Unmarshal([]byte(fields["key"]), &key); err != nil {
+		return Key{}, err
+	}
+	if used, err := strconv.ParseInt(fields["last_used"], 10, 64); err == nil {
+		key.LastUsedAt = time.Unix(0, used)
+	}
+	return key, nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, id string) error {
+	key, err := s.Get(ctx, id)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	pipe := s.client.WithContext(ctx).TxPipeline()
+	pipe.Del(s.keyName(id))
+	pipe.SRem(s.subjectName(key.Subject), id)
+	_, err = pipe.Exec()
+	return err
+}
+
+// touchScript sets the last used time of a key that still exists.
+var touchScript = goredis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+  redis.call('HSET', KEYS[1], 'last_used', ARGV[1])
+end
+return 1
+`)
+
+// Touch keeps the last used time in its own field so that it never races
+// with Save.
+func (s *RedisStore) Touch(ctx context.Context, id string, at time.Time) error {
+	return touchScript.Run(s.client.WithContext(ctx), []string{s.keyName(id)}, at.UnixNano()).Err()
+}
+
+// List drops the ids of expired keys from the subject set.
+func (s *RedisStore) List(ctx context.Context, subject string) ([]Key, error) {
+	ids, err := s.client.WithContext(ctx).SMembers(s.subjectName(subject)).Result()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]Key, 0, len(ids))
+	for _, id := range ids {
+		key, err := s.Get(ctx, id)
+		if err == ErrNotFound {
+			s.client.WithContext(ctx).SRem(s.subjectName(subject), id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	sortKeys(keys)
+	return keys, nil
+}
@@ -0,0 +1,85 @@
+package apikey
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store keeps the keys, it never sees a plaintext key.
+type Store interface {
+	Save(ctx context.Context, key Key) error
+	// Get returns ErrNotFound for an unknown id.
+	Get(ctx context.Context, id string) (Key, error)
+	Delete(ctx context.Context, id string) error
+	// Touch sets the last used time of the key of id.
+	Touch(ctx context.Context, id string, at time.Time) error
+	// List returns the keys of subject ordered by creation.
+	List(ctx context.Context, subject string) ([]Key, error)
+}
+
+// NewMemoryStore keeps keys in memory, for tests and single instance services.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: map[string]Key{}}
+}
+
+type MemoryStore struct {
+	mu   sync.RWMutex
+	keys map[string]Key
+}
+
+func (s *MemoryStore) Save(ctx context.Context, key Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key.ID] = key
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return Key{}, ErrNotFound
+	}
+	return key, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, id)
+	return nil
+}
+
+func (s *MemoryStore) Touch(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	key.LastUsedAt = at
+	s.keys[id] = key
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, subject string) ([]Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]Key, 0)
+	for _, key := range s.keys {
+		if key.Subject == subject {
+			keys = append(keys, key)
+		}
+	}
+	sortKeys(keys)
+	return keys, nil
+}
+
+func sortKeys(keys []Key) {
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+}
@@ -0,0 +1,223 @@
+// Package app runs a group of entry.Entry and stops them gracefully on exit signals.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/donech/tool/entry"
+	"github.com/donech/tool/xlog"
+)
+
+var defaultStopTimeout = 10 * time.Second
+
+// Errors aggregates the failures collected while running or stopping an App.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the collected errors for errors.Is and errors.As.
+func (e Errors) Unwrap() []error {
+	return e
+}
+
+// Is reports whether any collected error matches target, for toolchains
+// before go1.20 whose errors.Is does not know Unwrap() []error.
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first collected error that matches target.
+func (e Errors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Errors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+type cleanup struct {
+	name string
+	fn   func() error
+}
+
+type Option func(app *App)
+
+// WithEntries appends entries, they are started in order and stopped in reverse order.
+func WithEntries(entries ...entry.Entry) Option {
+	return func(app *App) {
+		app.entries = append(app.entries, entries...)
+	}
+}
+
+// WithCleanup registers a hook such as the func returned by xdb.Open, it runs after all entries are stopped.
+func WithCleanup(name string, fn func()) Option {
+	return func(app *App) {
+		app.cleanups = append(app.cleanups, cleanup{name: name, fn: func() error {
+			fn()
+			return nil
+		}})
+	}
+}
+
+// WithCloser registers a hook that may fail, such as redis.Client.Close or zap.Logger.Sync.
+func WithCloser(name string, fn func() error) Option {
+	return func(app *App) {
+		app.cleanups = append(app.cleanups, cleanup{name: name, fn: fn})
+	}
+}
+
+// WithStopTimeout sets the deadline given to each entry's Stop.
+func WithStopTimeout(d time.Duration) Option {
+	return func(app *App) {
+		app.stopTimeout = d
+	}
+}
+
+// WithSignals replaces the signals that trigger a graceful shutdown, default SIGINT and SIGTERM.
+func WithSignals(signals ...os.Signal) Option {
+	return func(app *App) {
+		app.signals = signals
+	}
+}
+
+func New(options ...Option) *App {
+	app := &App{
+		stopTimeout: defaultStopTimeout,
+		signals:     []os.Signal{syscall.SIGINT, syscall.SIGTERM},
+	}
+	for _, option := range options {
+		option(app)
+	}
+	return app
+}
+
+type App struct {
+	entries     []entry.Entry
+	cleanups    []cleanup
+	stopTimeout time.Duration
+	signals     []os.Signal
+	started     []entry.Entry
+}
+
+// Run starts all entries and blocks until ctx is done, a signal is received or
+// an entry's serve loop fails, then stops everything. The returned error holds
+// the start or serve failure followed by any stop and cleanup failures.
+func (a *App) Run(ctx context.Context) error {
+	var errs Errors
+	if err := a.start(); err != nil {
+		errs = append(errs, err)
+		return append(errs, a.stop()...).err()
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, a.signals...)
+	defer signal.Stop(sigCh)
+
+	quit := make(chan struct{})
+	fatal := a.watch(quit)
+	select {
+	case <-ctx.Done():
+		xlog.SS().Infof("app context done: %s", ctx.Err())
+	case sig := <-sigCh:
+		xlog.SS().Infof("app receive signal: %s", sig)
+	case err := <-fatal:
+		xlog.SS().Errorf("app entry serve failed: %s", err)
+		errs = append(errs, err)
+	}
+	close(quit)
+	return append(errs, a.stop()...).err()
+}
+
+func (a *App) start() error {
+	for _, en := range a.entries {
+		xlog.SS().Infof("app start entry %T", en)
+		if err := en.Run(); err != nil {
+			return fmt.Errorf("run entry %T: %w", en, err)
+		}
+		a.started = append(a.started, en)
+	}
+	return nil
+}
+
+func (a *App) watch(quit <-chan struct{}) <-chan error {
+	fatal := make(chan error, len(a.started))
+	for _, en := range a.started {
+		w, ok := en.(entry.Waiter)
+		if !ok {
+			continue
+		}
+		go func(en entry.Entry, w entry.Waiter) {
+			select {
+			case <-w.Done():
+				if err := w.Err(); err != nil {
+					fatal <- fmt.Errorf("serve entry %T: %w", en, err)
+				}
+			case <-quit:
+			}
+		}(en, w)
+	}
+	return fatal
+}
+
+func (a *App) stop() Errors {
+	var errs Errors
+	for i := len(a.started) - 1; i >= 0; i-- {
+		en := a.started[i]
+		xlog.SS().Infof("app stop entry %T", en)
+		ctx, cancel := context.WithTimeout(context.Background(), a.stopTimeout)
+		if err := en.Stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stop entry %T: %w", en, err))
+		}
+		cancel()
+	}
+	a.started = nil
+	for i := len(a.cleanups) - 1; i >= 0; i-- {
+		c := a.cleanups[i]
+		xlog.SS().Infof("app run cleanup %s", c.name)
+		if err := runCleanup(c); err != nil {
+			errs = append(errs, fmt.Errorf("cleanup %s: %w", c.name, err))
+		}
+	}
+	a.cleanups = nil
+	return errs
+}
+
+// runCleanup converts a panic into an error, xdb.Open's cleanup panics when Close fails.
+func runCleanup(c cleanup) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+				return
+			}
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return c.fn()
+}
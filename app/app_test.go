@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeEntry struct {
+	name   string
+	runErr error
+	events *[]string
+	done   chan struct{}
+	err    error
+}
+
+func newFakeEntry(name string, events *[]string) *fakeEntry {
+	return &fakeEntry{name: name, events: events, done: make(chan struct{})}
+}
+
+func (e *fakeEntry) Run() error {
+	*e.events = append(*e.events, "run "+e.name)
+	return e.runErr
+}
+
+func (e *fakeEntry) Stop(ctx context.Context) error {
+	*e.events = append(*e.events, "stop "+e.name)
+	if _, ok := ctx.Deadline(); !ok {
+		return errors.New("stop without deadline")
+	}
+	return nil
+}
+
+func (e *fakeEntry) Done() <-chan struct{} {
+	return e.done
+}
+
+func (e *fakeEntry) Err() error {
+	return e.err
+}
+
+func (e *fakeEntry) fail(err error) {
+	e.err = err
+	close(e.done)
+}
+
+func TestApp_Run(t *testing.T) {
+	assert := require.New(t)
+	var events []string
+	a := newFakeEntry("a", &events)
+	b := newFakeEntry("b", &events)
+	app := New(
+		WithEntries(a, b),
+		WithCleanup("db", func() { events = append(events, "cleanup db") }),
+		WithCloser("redis", func() error {
+			events = append(events, "cleanup redis")
+			return errors.New("redis closed")
+		}),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	err := app.Run(ctx)
+	assert.Error(err)
+	assert.Contains(err.Error(), "cleanup redis: redis closed")
+	assert.Equal([]string{"run a", "run b", "stop b", "stop a", "cleanup redis", "cleanup db"}, events)
+}
+
+func TestApp_RunStartFailed(t *testing.T) {
+	assert := require.New(t)
+	var events []string
+	a := newFakeEntry("a", &events)
+	b := newFakeEntry("b", &events)
+	b.runErr = errors.New("address already in use")
+	c := newFakeEntry("c", &events)
+	err := New(WithEntries(a, b, c)).Run(context.Background())
+	assert.Error(err)
+	assert.Contains(err.Error(), "address already in use")
+	assert.Equal([]string{"run a", "run b", "stop a"}, events)
+}
+
+func TestApp_RunServeFailed(t *testing.T) {
+	assert := require.New(t)
+	var events []string
+	a := newFakeEntry("a", &events)
+	serveErr := errors.New("serve failed")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		a.fail(serveErr)
+	}()
+	err := New(WithEntries(a)).Run(context.Background())
+	assert.True(errors.Is(err, serveErr))
+	assert.Equal([]string{"run a", "stop a"}, events)
+}
+
+func TestApp_CleanupPanic(t *testing.T) {
+	assert := require.New(t)
+	err := New(WithCleanup("db", func() { panic(errors.New("close failed")) })).stop().err()
+	assert.Error(err)
+	assert.Equal("cleanup db: close failed", err.Error())
+}
@@ -0,0 +1,208 @@
+// Package authz provides role based access control on top of the jwt claims
+// put into the context by the gin middleware and the grpc interceptor.
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/donech/tool/xjwt"
+)
+
+// DefaultRoleClaim is the claim roles are read from.
+const DefaultRoleClaim = "roles"
+
+var (
+	// ErrUnauthenticated is returned when the context carries no claims.
+	ErrUnauthenticated = errors.New("authz: unauthenticated")
+	// ErrForbidden is returned when the roles lack a required permission.
+	ErrForbidden = errors.New("authz: permission denied")
+)
+
+// Policy maps roles to permissions and grpc methods to the permissions they need.
+// A permission ending with * grants every permission with that prefix, e.g.
+// order:* grants order:read and order:write, * grants everything.
+type Policy struct {
+	// RoleClaim claim holding the roles, default roles. The claim may be a list
+	// or a string of roles separated by spaces or commas.
+	RoleClaim string `yaml:"roleClaim"`
+	// Roles maps a role to the permissions it grants.
+	Roles map[string][]string `yaml:"roles"`
+	// Inherits maps a role to the roles whose permissions it inherits.
+	Inherits map[string][]string `yaml:"inherits"`
+	// Methods maps a grpc full method to the permissions it requires. A key like
+	// /pkg.Service/* covers every method of the service, methods not covered
+	// are left to authentication.
+	Methods map[string][]string `yaml:"methods"`
+}
+
+// LoadPolicy parses a yaml policy.
+func LoadPolicy(data []byte) (Policy, error) {
+	p := Policy{}
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("authz: parse policy: %w", err)
+	}
+	return p, nil
+}
+
+// LoadPolicyFile parses the yaml policy at path.
+func LoadPolicyFile(path string) (Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Policy{}, fmt.Errorf("authz: read policy: %w", err)
+	}
+	return LoadPolicy(data)
+}
+
+// RBAC decides on the permissions of a set of roles, it is safe for concurrent use.
+type RBAC struct {
+	roleClaim   string
+	permissions map[string][]string
+	methods     map[string][]string
+}
+
+// New resolves the role hierarchy of policy, an unknown or cyclic inherited
+// role is an error.
+func New(policy Policy) (*RBAC, error) {
+	r := &RBAC{
+		roleClaim:   policy.RoleClaim,
+		permissions: map[string][]string{},
+		methods:     policy.Methods,
+	}
+	if r.roleClaim == "" {
+		r.roleClaim = DefaultRoleClaim
+	}
+	roles := map[string][]string{}
+	for role, perms := range policy.Roles {
+		roles[role] = perms
+	}
+	for role := range policy.Inherits {
+		if _, ok := roles[role]; !ok {
+			roles[role] = nil
+		}
+	}
+	policy.Roles = roles
+	for role := range policy.Roles {
+		perms := map[string]bool{}
+		if err := resolve(policy, role, map[string]bool{}, perms); err != nil {
+			return nil, err
+		}
+		list := make([]string, 0, len(perms))
+		for p := range perms {
+			list = append(list, p)
+		}
+		sort.Strings(list)
+		r.permissions[role] = list
+	}
+	return r, nil
+}
+
+func resolve(policy Policy, role string, visiting map[string]bool, perms map[string]bool) error {
+	if visiting[role] {
+		return fmt.Errorf("authz: role %s inherits itself", role)
+	}
+	if _, ok := policy.Roles[role]; !ok {
+		return fmt.Errorf("authz: unknown role %s", role)
+	}
+	visiting[role] = true
+	defer delete(visiting, role)
+	for _, p := range policy.Roles[role] {
+		perms[p] = true
+	}
+	for _, parent := range policy.Inherits[role] {
+		if err := resolve(policy, parent, visiting, perms); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Permissions returns the permissions granted to role, inherited ones included.
+func (r *RBAC) Permissions(role string) []string {
+	return r.permissions[role]
+}
+
+// Allowed reports whether any of roles grants permission.
+func (r *RBAC) Allowed(roles []string, permission string) bool {
+	for _, role := range roles {
+		for _, p := range r.permissions[role] {
+			if grants(p, permission) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func grants(granted, permission string) bool {
+	if strings.HasSuffix(granted, "*") {
+		return strings.HasPrefix(permission, strings.TrimSuffix(granted, "*"))
+	}
+	return granted == permission
+}
+
+// Roles reads the roles from the claims of ctx.
+func (r *RBAC) Roles(ctx context.Context) ([]string, bool) {
+	claims := xjwt.GetClaimsFromCtx(ctx)
+	if len(claims) == 0 {
+		return nil, false
+	}
+	switch v := claims[r.roleClaim].(type) {
+	case string:
+		return strings.FieldsFunc(v, func(c rune) bool { return c == ' ' || c == ',' }), true
+	case []string:
+		return v, true
+	case []interface{}:
+		roles := make([]string, 0, len(v))
+		for _, role := range v {
+			if s, ok := role.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+		return roles, true
+	}
+	return nil, true
+}
+
+// Authorize checks that the roles in the claims of ctx grant every permission.
+// It returns ErrUnauthenticated without claims and wraps ErrForbidden otherwise.
+func (r *RBAC) Authorize(ctx context.Context, permissions ...string) error {
+	roles, ok := r.Roles(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+	for _, p := range permissions {
+		if !r.Allowed(roles, p) {
+			return fmt.Errorf("%w: %s required", ErrForbidden, p)
+		}
+	}
+	return nil
+}
+
+// MethodPermissions returns the permissions required by a grpc full method,
+// an exact entry wins over a /pkg.Service/* entry.
+func (r *RBAC) MethodPermissions(fullMethod string) ([]string, bool) {
+	if perms, ok := r.methods[fullMethod]; ok {
+		return perms, true
+	}
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		perms, ok := r.methods[fullMethod[:i+1]+"*"]
+		return perms, ok
+	}
+	return nil, false
+}
+
+// AuthorizeMethod checks the permissions required by a grpc full method.
+func (r *RBAC) AuthorizeMethod(ctx context.Context, fullMethod string) error {
+	perms, ok := r.MethodPermissions(fullMethod)
+	if !ok {
+		return nil
+	}
+	return r.Authorize(ctx, perms...)
+}
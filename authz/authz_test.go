@@ -0,0 +1,78 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/donech/tool/xjwt"
+)
+
+const policyYAML = `
+roles:
+  viewer: [order:read]
+  editor: [order:write]
+  admin: ["*"]
+  support: ["order:*"]
+inherits:
+  editor: [viewer]
+  lead: [editor]
+methods:
+  /shop.Order/Get: [order:read]
+  /shop.Order/*: [order:write]
+`
+
+func TestRBAC(t *testing.T) {
+	assert := require.New(t)
+	policy, err := LoadPolicy([]byte(policyYAML))
+	assert.NoError(err)
+	r, err := New(policy)
+	assert.NoError(err)
+
+	assert.Equal([]string{"order:read", "order:write"}, r.Permissions("lead"))
+	assert.True(r.Allowed([]string{"lead"}, "order:read"))
+	assert.False(r.Allowed([]string{"viewer"}, "order:write"))
+	assert.True(r.Allowed([]string{"support"}, "order:refund"))
+	assert.False(r.Allowed([]string{"support"}, "user:read"))
+	assert.True(r.Allowed([]string{"viewer", "admin"}, "user:delete"))
+
+	perms, ok := r.MethodPermissions("/shop.Order/Get")
+	assert.True(ok)
+	assert.Equal([]string{"order:read"}, perms)
+	perms, ok = r.MethodPermissions("/shop.Order/Cancel")
+	assert.True(ok)
+	assert.Equal([]string{"order:write"}, perms)
+	_, ok = r.MethodPermissions("/shop.User/Get")
+	assert.False(ok)
+}
+
+func TestRBAC_Authorize(t *testing.T) {
+	assert := require.New(t)
+	policy, err := LoadPolicy([]byte(policyYAML))
+	assert.NoError(err)
+	r, err := New(policy)
+	assert.NoError(err)
+
+	assert.Equal(ErrUnauthenticated, r.Authorize(context.Background(), "order:read"))
+	for _, roles := range []interface{}{"viewer", "guest, viewer", []interface{}{"viewer"}, []string{"viewer"}} {
+		ctx := xjwt.SetClaimsToCtx(context.Background(), jwt.MapClaims{"roles": roles})
+		assert.NoError(r.Authorize(ctx, "order:read"), roles)
+		assert.True(errors.Is(r.Authorize(ctx, "order:read", "order:write"), ErrForbidden))
+		assert.NoError(r.AuthorizeMethod(ctx, "/shop.Order/Get"))
+		assert.True(errors.Is(r.AuthorizeMethod(ctx, "/shop.Order/Cancel"), ErrForbidden))
+		assert.NoError(r.AuthorizeMethod(ctx, "/shop.User/Get"))
+	}
+	ctx := xjwt.SetClaimsToCtx(context.Background(), jwt.MapClaims{"id": 1})
+	assert.True(errors.Is(r.Authorize(ctx, "order:read"), ErrForbidden))
+}
+
+func TestNew_InvalidHierarchy(t *testing.T) {
+	assert := require.New(t)
+	_, err := New(Policy{Inherits: map[string][]string{"a": {"b"}, "b": {"a"}}})
+	assert.Error(err)
+	_, err = New(Policy{Inherits: map[string][]string{"a": {"missing"}}})
+	assert.Error(err)
+}
@@ -7,8 +7,11 @@ import (
 	"time"
 
 	entsql "entgo.io/ent/dialect/sql"
+	"github.com/donech/tool/health"
+	"github.com/donech/tool/metrics"
 	"github.com/donech/tool/xlog"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
@@ -183,3 +186,17 @@ func DB(name ...string) *sql.DB {
 
 	return v.(*sql.DB)
 }
+
+// Checker returns a health.Checker that pings the named db.
+func Checker(name ...string) health.Checker {
+	return health.SQL(DB(name...))
+}
+
+// Collector returns a prometheus collector of the named db pool stats.
+func Collector(name ...string) prometheus.Collector {
+	dbName := Default
+	if len(name) > 0 {
+		dbName = name[0]
+	}
+	return metrics.SQL(dbName, DB(name...))
+}
@@ -8,3 +8,11 @@ type Entry interface {
 	Run() error
 	Stop(ctx context.Context) error
 }
+
+// Waiter is implemented by entries whose serve loop keeps running in the
+// background after Run returns. Done is closed when the loop exits and Err
+// reports why, nil meaning it was stopped on purpose.
+type Waiter interface {
+	Done() <-chan struct{}
+	Err() error
+}
@@ -1,6 +1,16 @@
 package gin
 
+import "github.com/donech/tool/xtls"
+
 type Config struct {
 	Mod  string `yaml:"mod"`
 	Addr string `yaml:"addr"`
+	// AdminAddr http address serving metrics and health probes apart from the
+	// application routes. When empty, metrics are served on Addr to every client of the api.
+	AdminAddr string `yaml:"adminAddr"`
+	// MetricsPath path serving metrics when WithMetrics is used, default /metrics.
+	// "-" serves no metrics route, mount metrics.Metrics.Handler where it fits.
+	MetricsPath string `yaml:"metricsPath"`
+	// TLS serves https when a certificate is configured, clients are verified when ClientAuth is set.
+	TLS xtls.Config `yaml:"tls"`
 }
@@ -2,58 +2,206 @@ package gin
 
 import (
 	"context"
+	"crypto/tls"
 	"log"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/donech/tool/entry/gin/middleware"
+	"github.com/donech/tool/health"
+	"github.com/donech/tool/metrics"
+	"github.com/donech/tool/xtls"
 
 	"go.uber.org/zap"
 
 	"github.com/gin-gonic/gin"
 )
 
-func NewEntry(conf *Config, router Router, logger *zap.Logger) *Entry {
+func NewEntry(conf *Config, router Router, logger *zap.Logger, options ...Option) *Entry {
 	engine := gin.New()
 	engine.Use(middleware.GinZap(time.RFC3339, true, conf.Mod))
 	engine.Use(middleware.RecoveryWithZap(true))
-	return &Entry{
+	if conf.TLS.ClientAuth {
+		engine.Use(middleware.PeerIdentity())
+	}
+	e := &Entry{
 		conf:   conf,
 		engine: engine,
 		router: router,
 		logger: logger,
+		done:   make(chan struct{}),
+	}
+	for _, option := range options {
+		option(e)
+	}
+	if e.metrics != nil {
+		engine.Use(middleware.Metrics(e.metrics))
+		if path := e.metricsPath(); path != "" && conf.AdminAddr == "" {
+			engine.GET(path, gin.WrapH(e.metrics.Handler()))
+		}
+	}
+	if e.health != nil {
+		engine.GET(health.HealthPath, gin.WrapH(health.HealthHandler(e.health)))
+		engine.GET(health.ReadinessPath, gin.WrapH(health.ReadinessHandler(e.health)))
+		engine.GET(health.LivenessPath, gin.WrapH(health.LivenessHandler()))
+	}
+	return e
+}
+
+type Option func(entry *Entry)
+
+// WithHealth serves /healthz, /readyz and /livez from registry, readiness
+// flips to down as soon as Stop begins.
+func WithHealth(registry *health.Registry) Option {
+	return func(entry *Entry) {
+		entry.health = registry
+	}
+}
+
+// WithMetrics records request metrics and serves them on Config.MetricsPath,
+// on Config.AdminAddr when it is set.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(entry *Entry) {
+		entry.metrics = m
 	}
 }
 
 type Entry struct {
-	conf   *Config
-	engine *gin.Engine
-	router Router
-	logger *zap.Logger
-	srv    *http.Server
+	conf    *Config
+	engine  *gin.Engine
+	router  Router
+	logger  *zap.Logger
+	srv     *http.Server
+	admin   *http.Server
+	health  *health.Registry
+	metrics *metrics.Metrics
+	tls     *xtls.Reloader
+	done    chan struct{}
+	err     error
 }
 
 func (e *Entry) Engine() *gin.Engine {
 	return e.engine
 }
 
+// Run binds the listener synchronously so that bind failures such as
+// "address already in use" are returned, then serves in the background.
+// Later serve failures are reported through Done and Err.
 func (e *Entry) Run() error {
 	srv := &http.Server{
 		Addr:    e.conf.Addr,
 		Handler: e.engine,
 	}
 	e.router.Init(e.engine)
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Println("listen http failed: ", err)
+		return err
+	}
+	if err := e.runAdmin(); err != nil {
+		listener.Close()
+		log.Println("listen http admin failed: ", err)
+		return err
+	}
+	srv.Addr = listener.Addr().String()
+	if e.conf.TLS.Enabled() {
+		reloader, err := xtls.NewReloader(e.conf.TLS)
+		if err != nil {
+			listener.Close()
+			e.closeAdmin()
+			log.Println("load tls certificate failed: ", err)
+			return err
+		}
+		e.tls = reloader
+		listener = tls.NewListener(listener, reloader.ServerConfig())
+	}
+	e.srv = srv
 	go func() {
-		log.Println("start http server at ", srv.Addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen: %s\n", err)
+		defer close(e.done)
+		log.Println("start http server at ", listener.Addr())
+		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Println("http serve failed: ", err)
+			e.err = err
+		}
+	}()
+	return nil
+}
+
+// metricsPath returns where metrics are served, empty when MetricsPath is "-".
+func (e *Entry) metricsPath() string {
+	switch e.conf.MetricsPath {
+	case "-":
+		return ""
+	case "":
+		return metrics.DefaultPath
+	}
+	return e.conf.MetricsPath
+}
+
+// runAdmin serves metrics and health probes on AdminAddr.
+func (e *Entry) runAdmin() error {
+	if e.conf.AdminAddr == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	if path := e.metricsPath(); e.metrics != nil && path != "" {
+		mux.Handle(path, e.metrics.Handler())
+	}
+	if e.health != nil {
+		health.Mount(mux, e.health)
+	}
+	listener, err := net.Listen("tcp", e.conf.AdminAddr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Addr: listener.Addr().String(), Handler: mux}
+	e.admin = srv
+	go func() {
+		log.Println("start http admin server at ", listener.Addr())
+		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Println("http admin serve failed: ", err)
 		}
 	}()
-	e.srv = srv
 	return nil
 }
 
+func (e *Entry) closeAdmin() {
+	if e.admin != nil {
+		e.admin.Close()
+	}
+}
+
+// Done is closed when the serve loop exits.
+func (e *Entry) Done() <-chan struct{} {
+	return e.done
+}
+
+// Err returns the serve failure once Done is closed, nil otherwise.
+func (e *Entry) Err() error {
+	select {
+	case <-e.done:
+		return e.err
+	default:
+		return nil
+	}
+}
+
 func (e *Entry) Stop(ctx context.Context) error {
+	if e.srv == nil {
+		return nil
+	}
+	if e.health != nil {
+		e.health.Drain(ctx)
+	}
+	if e.tls != nil {
+		defer e.tls.Close()
+	}
+	defer e.closeAdmin()
 	err := e.srv.Shutdown(ctx)
 	if err != nil {
 		log.Println("Http Server Shutdown failed: ", err)
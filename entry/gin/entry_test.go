@@ -0,0 +1,128 @@
+package gin
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/donech/tool/health"
+	"github.com/donech/tool/metrics"
+	"github.com/donech/tool/xtls"
+	"github.com/donech/tool/xtls/xtlstest"
+)
+
+func TestEntry_RunAddressInUse(t *testing.T) {
+	assert := require.New(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer l.Close()
+
+	e := NewEntry(&Config{Mod: "test", Addr: l.Addr().String()}, &DefaultRouter{}, zap.NewNop())
+	assert.Error(e.Run())
+	assert.NoError(e.Stop(context.Background()))
+}
+
+func TestEntry_RunAndStop(t *testing.T) {
+	assert := require.New(t)
+	e := NewEntry(&Config{Mod: "test", Addr: "127.0.0.1:0"}, &DefaultRouter{}, zap.NewNop())
+	assert.NoError(e.Run())
+	assert.NoError(e.Err())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(e.Stop(ctx))
+	<-e.Done()
+	assert.NoError(e.Err())
+}
+
+func TestEntry_Health(t *testing.T) {
+	assert := require.New(t)
+	registry := health.NewRegistry()
+	e := NewEntry(&Config{Mod: "test", Addr: "127.0.0.1:0"}, &DefaultRouter{}, zap.NewNop(), WithHealth(registry))
+	assert.NoError(e.Run())
+
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		e.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+	assert.Equal(http.StatusOK, serve(health.ReadinessPath))
+	assert.NoError(e.Stop(context.Background()))
+	assert.Equal(http.StatusServiceUnavailable, serve(health.ReadinessPath))
+	assert.Equal(http.StatusOK, serve(health.LivenessPath))
+}
+
+func TestEntry_MetricsAdmin(t *testing.T) {
+	assert := require.New(t)
+	serve := func(e *Entry, path string) int {
+		w := httptest.NewRecorder()
+		e.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	e := NewEntry(&Config{Mod: "test", Addr: "127.0.0.1:0", AdminAddr: "127.0.0.1:0"}, &DefaultRouter{}, zap.NewNop(),
+		WithMetrics(metrics.New("gin_admin")))
+	assert.NoError(e.Run())
+	defer e.Stop(context.Background())
+	assert.Equal(http.StatusNotFound, serve(e, metrics.DefaultPath))
+	resp, err := http.Get("http://" + e.admin.Addr + metrics.DefaultPath)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	e = NewEntry(&Config{Mod: "test", Addr: "127.0.0.1:0", MetricsPath: "-"}, &DefaultRouter{}, zap.NewNop(),
+		WithMetrics(metrics.New("gin_none")))
+	assert.Equal(http.StatusNotFound, serve(e, metrics.DefaultPath))
+}
+
+type identityController struct{}
+
+func (identityController) RegisterRoute(group *gin.RouterGroup) {
+	group.GET("/whoami", func(c *gin.Context) {
+		identity, _ := xtls.GetIdentityFromCtx(c.Request.Context())
+		c.String(http.StatusOK, identity.CommonName)
+	})
+}
+
+func TestEntry_MutualTLS(t *testing.T) {
+	assert := require.New(t)
+	dir, err := ioutil.TempDir("", "gin")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	ca, err := xtlstest.NewCA(dir)
+	assert.NoError(err)
+	serverConf, err := ca.Issue(dir, "server", 2)
+	assert.NoError(err)
+	serverConf.ClientAuth = true
+	clientConf, err := ca.Issue(dir, "client", 3)
+	assert.NoError(err)
+
+	router := &DefaultRouter{}
+	router.RegisterController(identityController{})
+	e := NewEntry(&Config{Mod: "test", Addr: "127.0.0.1:0", TLS: serverConf}, router, zap.NewNop())
+	assert.NoError(e.Run())
+	defer e.Stop(context.Background())
+
+	tlsConfig, err := xtls.LoadClientConfig(clientConf)
+	assert.NoError(err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := client.Get("https://" + e.srv.Addr + "/whoami")
+	assert.NoError(err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal("client", string(body))
+
+	tlsConfig.GetClientCertificate = nil
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	_, err = client.Get("https://" + e.srv.Addr + "/whoami")
+	assert.Error(err)
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/donech/tool/apikey"
+	"github.com/donech/tool/xjwt"
+	"github.com/donech/tool/xlog"
+)
+
+var headerAPIKey = "X-API-Key"
+
+// APIKey authenticates the api key of the X-API-Key header, the key must grant
+// every scope. The claims of the key are put where MiddleWareImpl puts the jwt
+// claims, and the key itself is available through apikey.FromContext. Failures
+// are written by DefaultUnauthorizedHandler.
+func APIKey(m *apikey.Manager, scopes ...string) gin.HandlerFunc {
+	return apiKey(m, DefaultUnauthorizedHandler, scopes)
+}
+
+// APIKey is the package APIKey writing failures through the UnauthorizedHandler
+// of the middleware.
+func (j JWTMiddleware) APIKey(m *apikey.Manager, scopes ...string) gin.HandlerFunc {
+	return apiKey(m, j.unauthorizedHandler, scopes)
+}
+
+func apiKey(m *apikey.Manager, unauthorized UnauthorizedHandler, scopes []string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		plaintext := ctx.GetHeader(headerAPIKey)
+		if plaintext == "" {
+			unauthorized(ctx, CodeTokenMissing, "api_key_missing", TokenNotFoundErr)
+			ctx.Abort()
+			return
+		}
+		key, err := m.Authenticate(ctx.Request.Context(), plaintext, scopes...)
+		if err != nil {
+			xlog.S(ctx.Request.Context()).Warnf("authenticate api key failed: %s", err)
+			switch err {
+			case apikey.ErrInsufficientScope:
+				unauthorized(ctx, CodeInsufficientScope, "insufficient_scope", err)
+			case apikey.ErrExpired:
+				unauthorized(ctx, CodeTokenExpired, "api_key_expired", err)
+			default:
+				unauthorized(ctx, CodeTokenInvalid, "invalid_api_key", err)
+			}
+			ctx.Abort()
+			return
+		}
+		c := apikey.NewContext(ctx.Request.Context(), key)
+		ctx.Request = ctx.Request.WithContext(c)
+		ctx.Set(string(xjwt.CtxJWTKey), xjwt.GetClaimsFromCtx(c))
+		ctx.Next()
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/donech/tool/apikey"
+	"github.com/donech/tool/xjwt"
+)
+
+func TestAPIKey(t *testing.T) {
+	assert := require.New(t)
+	m := apikey.NewManager(apikey.NewMemoryStore())
+	plaintext, _, err := m.Issue(context.Background(), apikey.IssueRequest{Subject: "svc", Scopes: []string{"order:read"}})
+	assert.NoError(err)
+	engine := gin.New()
+	handler := func(c *gin.Context) {
+		c.String(http.StatusOK, "%v", xjwt.GetClaimsFromCtx(c.Request.Context())["sub"])
+	}
+	engine.GET("/orders", APIKey(m, "order:read"), handler)
+	engine.POST("/orders", APIKey(m, "order:write"), handler)
+	call := func(method, key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/orders", nil)
+		req.Header.Set("X-API-Key", key)
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call(http.MethodGet, plaintext)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("svc", w.Body.String())
+	w = call(http.MethodPost, plaintext)
+	assert.Equal(http.StatusForbidden, w.Code)
+	assert.JSONEq(`{"code":40301,"msg":"forbidden","data":{"reason":"insufficient_scope"}}`, w.Body.String())
+	w = call(http.MethodGet, "ak_0000_0000")
+	assert.Equal(http.StatusUnauthorized, w.Code)
+	assert.JSONEq(`{"code":40105,"msg":"unauthorized","data":{"reason":"invalid_api_key"}}`, w.Body.String())
+	assert.Equal(http.StatusUnauthorized, call(http.MethodGet, "").Code)
+}
+
+func TestJWTMiddleware_APIKey(t *testing.T) {
+	assert := require.New(t)
+	m := apikey.NewManager(apikey.NewMemoryStore())
+	plaintext, _, err := m.Issue(context.Background(), apikey.IssueRequest{Subject: "svc", Scopes: []string{"order:read"}})
+	assert.NoError(err)
+	var codes []int
+	j := NewJWTMiddleware(WithUnauthorizedHandler(func(ctx *gin.Context, code int, reason string, err error) {
+		codes = append(codes, code)
+		ctx.String(http.StatusTeapot, reason)
+	}))
+	engine := gin.New()
+	engine.POST("/orders", j.APIKey(m, "order:write"), func(c *gin.Context) { c.Status(http.StatusOK) })
+	for _, key := range []string{plaintext, "ak_0000_0000", ""} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		req.Header.Set("X-API-Key", key)
+		engine.ServeHTTP(w, req)
+		assert.Equal(http.StatusTeapot, w.Code)
+	}
+	assert.Equal([]int{CodeInsufficientScope, CodeTokenInvalid, CodeTokenMissing}, codes)
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/donech/tool/authz"
+	"github.com/donech/tool/xlog"
+)
+
+var errNoAuthorizer = errors.New("authz: no authorizer, see WithAuthorizer")
+
+// WithAuthorizer sets the RBAC used by Require.
+func WithAuthorizer(rbac *authz.RBAC) Option {
+	return func(m *JWTMiddleware) {
+		m.authorizer = rbac
+	}
+}
+
+// Require guards a route with permissions, e.g. Require("order:write"). It must
+// run after MiddleWareImpl, requests whose roles lack any of the permissions
+// are aborted through the errResponseHandler.
+func (j JWTMiddleware) Require(permissions ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		err := errNoAuthorizer
+		if j.authorizer != nil {
+			err = j.authorizer.Authorize(ctx.Request.Context(), permissions...)
+		}
+		if err != nil {
+			xlog.S(ctx.Request.Context()).Warnf("authorize %s %s failed: %s", ctx.Request.Method, ctx.FullPath(), err)
+			j.errResponseHandler(ctx, j.errorCode, err.Error(), nil)
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
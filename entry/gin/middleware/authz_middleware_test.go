@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/donech/tool/authz"
+	"github.com/donech/tool/xjwt"
+)
+
+func TestJWTMiddleware_Require(t *testing.T) {
+	assert := require.New(t)
+	rbac, err := authz.New(authz.Policy{
+		Roles:    map[string][]string{"viewer": {"order:read"}, "editor": {"order:write"}},
+		Inherits: map[string][]string{"editor": {"viewer"}},
+	})
+	assert.NoError(err)
+	f, err := xjwt.NewJWTFactory(xjwt.Config{SingingAlgorithm: "HS256", Key: "12312asdasd"},
+		xjwt.WithLoginFunc(func(ctx context.Context, form xjwt.LoginForm) (jwt.MapClaims, error) {
+			return jwt.MapClaims{"username": form.Username, "roles": []string{form.Username}}, nil
+		}))
+	assert.NoError(err)
+	m := NewJWTMiddleware(WithFactory(*f), WithTokenLookup("header:auth"), WithAuthorizer(rbac), WithErrorCode(403))
+	engine := gin.New()
+	engine.POST("/orders", m.MiddleWareImpl(), m.Require("order:write"), func(c *gin.Context) {
+		c.String(http.StatusOK, "created")
+	})
+
+	call := func(role string) string {
+		token, err := f.GenerateToken(context.Background(), xjwt.LoginForm{Username: role, Password: "pass"})
+		assert.NoError(err)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		req.Header.Set("auth", token)
+		engine.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	assert.Equal("created", call("editor"))
+	assert.JSONEq(`{"code":403,"msg":"authz: permission denied: order:write required","data":null}`, call("viewer"))
+}
@@ -1,10 +1,11 @@
 package middleware
 
 import (
-	"context"
 	"errors"
+	"net/http"
 	"strings"
 
+	"github.com/donech/tool/authz"
 	"github.com/donech/tool/xjwt"
 	"github.com/donech/tool/xlog"
 	"github.com/gin-gonic/gin"
@@ -16,13 +17,87 @@ var errCode = 1
 var tokenName = "token"
 
 type JWTMiddleware struct {
-	factory            xjwt.JWTFactory
-	tokenLookup        string
-	responseHandler    ResponseHandler
-	errResponseHandler ResponseHandler
-	successCode        int
-	errorCode          int
-	tokenName          string
+	factory             xjwt.JWTFactory
+	tokenLookup         string
+	responseHandler     ResponseHandler
+	errResponseHandler  ResponseHandler
+	successCode         int
+	errorCode           int
+	tokenName           string
+	tokenPair           bool
+	cookie              *CookieConfig
+	authorizer          *authz.RBAC
+	unauthorizedHandler UnauthorizedHandler
+}
+
+// Error codes passed to the UnauthorizedHandler.
+const (
+	CodeTokenMissing   = 40101
+	CodeTokenMalformed = 40102
+	CodeTokenExpired   = 40103
+	CodeTokenRevoked   = 40104
+	CodeTokenInvalid   = 40105
+	// CodeInsufficientScope is the error code of a credential lacking a required scope.
+	CodeInsufficientScope = 40301
+)
+
+// UnauthorizedHandler writes the response of a request failing authentication,
+// code is one of the CodeToken* constants and reason the xjwt.ErrorReason of err,
+// or token_missing. APIKey passes CodeInsufficientScope for keys lacking a scope.
+// The request is aborted after the handler returns.
+type UnauthorizedHandler func(ctx *gin.Context, code int, reason string, err error)
+
+// DefaultUnauthorizedHandler responds 401 with the {code,msg,data} envelope,
+// or 403 for CodeInsufficientScope, err is not exposed to the client.
+func DefaultUnauthorizedHandler(ctx *gin.Context, code int, reason string, err error) {
+	if code == CodeInsufficientScope {
+		ctx.JSON(http.StatusForbidden, gin.H{"code": code, "msg": "forbidden", "data": gin.H{"reason": reason}})
+		return
+	}
+	ctx.JSON(http.StatusUnauthorized, gin.H{"code": code, "msg": "unauthorized", "data": gin.H{"reason": reason}})
+}
+
+// UnauthorizedCode classifies an authentication error.
+func UnauthorizedCode(err error) (code int, reason string) {
+	switch {
+	case errors.Is(err, TokenNotFoundErr):
+		return CodeTokenMissing, "token_missing"
+	case errors.Is(err, xjwt.ErrTokenMalformed):
+		return CodeTokenMalformed, xjwt.ErrorReason(err)
+	case errors.Is(err, xjwt.ErrTokenExpired):
+		return CodeTokenExpired, xjwt.ErrorReason(err)
+	case errors.Is(err, xjwt.ErrTokenRevoked):
+		return CodeTokenRevoked, xjwt.ErrorReason(err)
+	}
+	return CodeTokenInvalid, xjwt.ErrorReason(err)
+}
+
+// CookieConfig makes the token handlers hand the tokens to browsers as cookies,
+// the middleware reads the access token cookie back.
+type CookieConfig struct {
+	// Name of the access token cookie, defaults to the token name.
+	Name string `yaml:"name"`
+	// RefreshName of the refresh token cookie, defaults to Name + "_refresh".
+	RefreshName string `yaml:"refreshName"`
+	Domain      string `yaml:"domain"`
+	// Path defaults to "/".
+	Path     string `yaml:"path"`
+	Secure   bool   `yaml:"secure"`
+	HTTPOnly bool   `yaml:"httpOnly"`
+	// SameSite is one of lax, strict or none, empty leaves the browser default.
+	SameSite string `yaml:"sameSite"`
+}
+
+func (c CookieConfig) sameSite() http.SameSite {
+	switch strings.ToLower(c.SameSite) {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteDefaultMode
 }
 
 type ResponseHandler func(ctx *gin.Context, code int, msg string, data interface{})
@@ -63,23 +138,58 @@ func WithTokenName(name string) Option {
 	}
 }
 
+// WithTokenPair makes GenerateTokenHandler issue an access and refresh token
+// pair, see RefreshTokenHandler. The factory needs a revocation store.
+func WithTokenPair(enable bool) Option {
+	return func(m *JWTMiddleware) {
+		m.tokenPair = enable
+	}
+}
+
+// WithCookie makes GenerateTokenHandler and RefreshTokenHandler set the tokens
+// as cookies and LogoutHandler clear them, the default token lookup then falls
+// back to the access token cookie.
+func WithCookie(cookie CookieConfig) Option {
+	return func(m *JWTMiddleware) {
+		m.cookie = &cookie
+	}
+}
+
 func WithResponseHandler(handler ResponseHandler) Option {
 	return func(m *JWTMiddleware) {
 		m.responseHandler = handler
 	}
 }
 
+// WithUnauthorizedHandler replaces DefaultUnauthorizedHandler. Without it a
+// middleware configured WithErrResponseHandler or WithErrorCode reports
+// authentication failures through those, see ErrUnauthorizedHandler.
+func WithUnauthorizedHandler(handler UnauthorizedHandler) Option {
+	return func(m *JWTMiddleware) {
+		m.unauthorizedHandler = handler
+	}
+}
+
 func WithErrResponseHandler(handler ResponseHandler) Option {
 	return func(m *JWTMiddleware) {
 		m.errResponseHandler = handler
 	}
 }
 
+// ErrUnauthorizedHandler reports authentication failures through handler with
+// errorCode, the CodeToken* code and reason are passed as data.
+func ErrUnauthorizedHandler(handler ResponseHandler, errorCode int) UnauthorizedHandler {
+	return func(ctx *gin.Context, code int, reason string, err error) {
+		handler(ctx, errorCode, "unauthorized", gin.H{"code": code, "reason": reason})
+	}
+}
+
 func NewJWTMiddleware(opts ...Option) JWTMiddleware {
 	m := JWTMiddleware{}
 	for _, o := range opts {
 		o(&m)
 	}
+	errConfigured := m.errResponseHandler != nil || m.errorCode != 0
 	if m.responseHandler == nil {
 		m.responseHandler = DefaultResponseHandler
 	}
@@ -91,52 +201,215 @@ func NewJWTMiddleware(opts ...Option) JWTMiddleware {
 		m.errorCode = errCode
 	}
 
+	if m.unauthorizedHandler == nil {
+		m.unauthorizedHandler = DefaultUnauthorizedHandler
+		if errConfigured {
+			m.unauthorizedHandler = ErrUnauthorizedHandler(m.errResponseHandler, m.errorCode)
+		}
+	}
+
 	if m.tokenName == "" {
 		m.tokenName = tokenName
 	}
 
+	if m.cookie != nil {
+		if m.cookie.Name == "" {
+			m.cookie.Name = m.tokenName
+		}
+		if m.cookie.RefreshName == "" {
+			m.cookie.RefreshName = m.cookie.Name + "_refresh"
+		}
+		if m.cookie.Path == "" {
+			m.cookie.Path = "/"
+		}
+	}
+
 	if m.tokenLookup == "" {
 		m.tokenLookup = "header:" + m.tokenName
+		if m.cookie != nil {
+			m.tokenLookup += ",cookie:" + m.cookie.Name
+		}
 	}
 	return m
 }
 
+// GenerateTokenHandler issues a token for the grant_type of the request, see
+// xjwt.GrantRequest, the password grant is used when it is missing.
 func (j JWTMiddleware) GenerateTokenHandler() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		f := xjwt.LoginForm{}
+		req := xjwt.GrantRequest{}
+		err := ctx.ShouldBind(&req)
+		if err != nil {
+			j.errResponseHandler(ctx, j.errorCode, err.Error(), nil)
+			return
+		}
+		if j.tokenPair {
+			pair, err := j.factory.GenerateTokenPairForGrant(ctx.Request.Context(), req)
+			if err != nil {
+				j.errResponseHandler(ctx, j.errorCode, err.Error(), nil)
+				return
+			}
+			j.respondPair(ctx, pair)
+			return
+		}
+		token, err := j.factory.GenerateTokenForGrant(ctx.Request.Context(), req)
+		if err != nil {
+			j.errResponseHandler(ctx, j.errorCode, err.Error(), nil)
+			return
+		}
+		j.respondToken(ctx, token)
+	}
+}
+
+// respondToken responds with token, setting its cookie in cookie mode.
+func (j JWTMiddleware) respondToken(ctx *gin.Context, token string) {
+	if j.cookie != nil {
+		j.setCookie(ctx, j.cookie.Name, token, int(j.factory.Timeout().Seconds()))
+	}
+	j.responseHandler(ctx, j.successCode, "success", gin.H{"token": token})
+}
+
+// respondPair responds with pair, setting its cookies in cookie mode.
+func (j JWTMiddleware) respondPair(ctx *gin.Context, pair xjwt.TokenPair) {
+	j.setPairCookies(ctx, pair)
+	j.responseHandler(ctx, j.successCode, "success", pairResponse(pair))
+}
+
+// RefreshTokenHandler spends the refresh_token of the request for a new token pair,
+// in cookie mode the refresh token cookie is used when the request carries none.
+func (j JWTMiddleware) RefreshTokenHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		f := xjwt.RefreshForm{}
 		err := ctx.ShouldBind(&f)
+		if err != nil && j.cookie != nil {
+			f.RefreshToken, _ = ctx.Cookie(j.cookie.RefreshName)
+		}
+		if f.RefreshToken == "" {
+			j.errResponseHandler(ctx, j.errorCode, err.Error(), nil)
+			return
+		}
+		pair, err := j.factory.Refresh(ctx.Request.Context(), f.RefreshToken)
 		if err != nil {
+			xlog.S(ctx.Request.Context()).Warnf("refresh jwt-token failed: %s", err)
 			j.errResponseHandler(ctx, j.errorCode, err.Error(), nil)
 			return
 		}
-		token, err := j.factory.GenerateToken(ctx.Request.Context(), f)
+		j.respondPair(ctx, pair)
+	}
+}
+
+// LogoutHandler revokes the token of the request along with its token family,
+// in cookie mode the token cookies are cleared as well.
+func (j JWTMiddleware) LogoutHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token, err := j.GetToken(ctx)
 		if err != nil {
 			j.errResponseHandler(ctx, j.errorCode, err.Error(), nil)
 			return
 		}
-		j.responseHandler(ctx, j.successCode, "success", gin.H{"token": token})
+		if err := j.factory.Logout(ctx.Request.Context(), token); err != nil {
+			j.errResponseHandler(ctx, j.errorCode, err.Error(), nil)
+			return
+		}
+		if j.cookie != nil {
+			j.setCookie(ctx, j.cookie.Name, "", -1)
+			j.setCookie(ctx, j.cookie.RefreshName, "", -1)
+		}
+		j.responseHandler(ctx, j.successCode, "success", nil)
 	}
 }
 
+func (j JWTMiddleware) setPairCookies(ctx *gin.Context, pair xjwt.TokenPair) {
+	if j.cookie == nil {
+		return
+	}
+	j.setCookie(ctx, j.cookie.Name, pair.AccessToken, int(pair.ExpiresIn))
+	j.setCookie(ctx, j.cookie.RefreshName, pair.RefreshToken, int(pair.RefreshExpiresIn))
+}
+
+// setCookie sets a token cookie, a negative maxAge deletes it.
+func (j JWTMiddleware) setCookie(ctx *gin.Context, name, value string, maxAge int) {
+	http.SetCookie(ctx.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     j.cookie.Path,
+		Domain:   j.cookie.Domain,
+		MaxAge:   maxAge,
+		Secure:   j.cookie.Secure,
+		HttpOnly: j.cookie.HTTPOnly,
+		SameSite: j.cookie.sameSite(),
+	})
+}
+
+func pairResponse(pair xjwt.TokenPair) gin.H {
+	return gin.H{
+		"token":              pair.AccessToken,
+		"refresh_token":      pair.RefreshToken,
+		"token_type":         pair.TokenType,
+		"expires_in":         pair.ExpiresIn,
+		"refresh_expires_in": pair.RefreshExpiresIn,
+	}
+}
+
+// JWKSHandler serves the public keys of the factory, mount it on xjwt.JWKSPath.
+func (j JWTMiddleware) JWKSHandler() gin.HandlerFunc {
+	return gin.WrapH(xjwt.JWKSHandler(j.factory.KeySet()))
+}
+
+// MiddleWareImpl rejects requests without a valid token through the
+// UnauthorizedHandler, the claims are put into the request context and the
+// gin.Context keys.
 func (j JWTMiddleware) MiddleWareImpl() gin.HandlerFunc {
+	return j.authenticate(false)
+}
+
+// OptionalMiddleWareImpl lets anonymous requests through and sets the claims
+// when the request carries a token, an invalid token is still rejected.
+func (j JWTMiddleware) OptionalMiddleWareImpl() gin.HandlerFunc {
+	return j.authenticate(true)
+}
+
+func (j JWTMiddleware) authenticate(optional bool) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		token, err := j.GetToken(ctx)
+		if err != nil && optional {
+			ctx.Next()
+			return
+		}
+		if err != nil {
+			j.unauthorized(ctx, err)
+			return
+		}
+		claims, err := j.factory.GetClaimsContext(ctx.Request.Context(), token)
 		if err != nil {
-			ctx.AbortWithStatusJSON(401, gin.H{"msg": "get jwt-token failed: " + err.Error()})
+			j.unauthorized(ctx, err)
 			return
 		}
-		claims, err := j.factory.GetClaims(token)
+		c, err := j.factory.NewContext(ctx.Request.Context(), claims)
 		if err != nil {
-			ctx.AbortWithStatusJSON(401, gin.H{"msg": "get jwt-claims failed: " + err.Error()})
+			j.unauthorized(ctx, err)
 			return
 		}
-		c := context.WithValue(ctx.Request.Context(), xjwt.CtxJWTKey, claims)
 		ctx.Request = ctx.Request.WithContext(c)
+		ctx.Set(string(xjwt.CtxJWTKey), claims)
+		if typed := xjwt.GetTypedClaimsFromCtx(c); typed != nil {
+			ctx.Set(string(xjwt.CtxTypedClaimKey), typed)
+		}
 		xlog.S(ctx.Request.Context()).Infof("set claims to ctx, key=%#v, claims=%#v", xjwt.CtxJWTKey, claims)
 		ctx.Next()
 	}
 }
 
+func (j JWTMiddleware) unauthorized(ctx *gin.Context, err error) {
+	code, reason := UnauthorizedCode(err)
+	xlog.S(ctx.Request.Context()).Warnf("authenticate %s %s failed: %s", ctx.Request.Method, ctx.Request.URL.Path, err)
+	j.unauthorizedHandler(ctx, code, reason, err)
+	ctx.Abort()
+}
+
+// GetToken looks the token up in the sources of tokenLookup in order, e.g.
+// "header:Authorization,query:token,cookie:token,form:token,param:token".
+// A "Bearer " prefix of a header token is stripped.
 func (j JWTMiddleware) GetToken(ctx *gin.Context) (token string, err error) {
 	scopes := strings.Split(j.tokenLookup, ",")
 	for _, scope := range scopes {
@@ -150,7 +423,15 @@ func (j JWTMiddleware) GetToken(ctx *gin.Context) (token string, err error) {
 		method, key := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
 		switch method {
 		case "header":
-			token, err = getTokenFromHeader(ctx, key)
+			token = getTokenFromHeader(ctx, key)
+		case "query":
+			token = ctx.Query(key)
+		case "cookie":
+			token, _ = ctx.Cookie(key)
+		case "form":
+			token = ctx.PostForm(key)
+		case "param":
+			token = ctx.Param(key)
 		}
 	}
 	if token == "" {
@@ -159,7 +440,12 @@ func (j JWTMiddleware) GetToken(ctx *gin.Context) (token string, err error) {
 	return token, err
 }
 
-func getTokenFromHeader(ctx *gin.Context, key string) (token string, err error) {
-	token = ctx.Request.Header.Get(key)
-	return
+const bearerPrefix = "bearer "
+
+func getTokenFromHeader(ctx *gin.Context, key string) string {
+	token := strings.TrimSpace(ctx.Request.Header.Get(key))
+	if len(token) > len(bearerPrefix) && strings.EqualFold(token[:len(bearerPrefix)], bearerPrefix) {
+		token = strings.TrimSpace(token[len(bearerPrefix):])
+	}
+	return token
 }
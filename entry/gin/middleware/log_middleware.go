@@ -13,6 +13,7 @@ import (
 	"os"
 	"runtime/debug"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/donech/tool/xlog"
@@ -71,12 +72,9 @@ func (w bodyLogWriter) needWriteBody() bool {
 //   3. A string stating whether to xlog response body
 func GinZap(timeFormat string, utc bool, mod string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		start := time.Now()
 		bodyLogWriter := &bodyLogWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer, mode: mod}
 		c.Writer = bodyLogWriter
-		// some evil middlewares modify this values
-		path := c.Request.URL.Path
-		query := c.Request.URL.RawQuery
+		// some evil middlewares modify this values, NewAccessLog keeps a copy
 		header := c.Request.Header
 
 		// 注入 trace-id
@@ -90,16 +88,8 @@ func GinZap(timeFormat string, utc bool, mod string) gin.HandlerFunc {
 		}
 		c.Request = c.Request.WithContext(ctx)
 		c.Header(string(xtrace.KeyName), traceID)
-		xlog.L(ctx).Info("Request receive:",
-			zap.String(string(xtrace.KeyName), traceID),
-			zap.String("path", path),
-			zap.String("method", c.Request.Method),
-			zap.Reflect("header", header),
-			zap.String("query", query),
-			zap.String("ip", c.ClientIP()),
-			zap.String("user-agent", c.Request.UserAgent()),
-			zap.String("time", start.Format(timeFormat)),
-		)
+		accessLog := NewAccessLog(c.Request, traceID, c.ClientIP(), timeFormat, utc)
+		accessLog.Request(ctx, header)
 
 		//不再记录请求body, 接收参数由内部方法自行记录
 		//if c.Request.ContentLength < 1024 {
@@ -116,14 +106,9 @@ func GinZap(timeFormat string, utc bool, mod string) gin.HandlerFunc {
 		//		zap.String("body", string(body)),
 		//	)
 		//}
-		connectionNum++
+		atomic.AddInt64(&connectionNum, 1)
 		c.Next()
-		connectionNum--
-		end := time.Now()
-		latency := end.Sub(start)
-		if utc {
-			end = end.UTC()
-		}
+		atomic.AddInt64(&connectionNum, -1)
 
 		if len(c.Errors) > 0 {
 			// Append error field if this is an erroneous request.
@@ -131,23 +116,74 @@ func GinZap(timeFormat string, utc bool, mod string) gin.HandlerFunc {
 				xlog.L(ctx).Error(e)
 			}
 		} else {
-			responseBody := bodyLogWriter.body.String()
-			header = bodyLogWriter.Header()
-			xlog.L(ctx).Info("Request response:：",
-				zap.String(string(xtrace.KeyName), traceID),
-				zap.String("path", path),
-				zap.String("method", c.Request.Method),
-				zap.Reflect("header", header),
-				zap.String("query", query),
-				zap.Int("status", c.Writer.Status()),
-				zap.String("time", end.Format(timeFormat)),
-				zap.Duration("latency", latency),
-				zap.String("body", responseBody),
-			)
+			accessLog.Response(ctx, bodyLogWriter.Header(), c.Writer.Status(), bodyLogWriter.body.String())
 		}
 	}
 }
 
+// AccessLog holds the request values logged by GinZap, the grpc gateway
+// shares it so that both write the same access log fields.
+type AccessLog struct {
+	TraceID    string
+	Path       string
+	Query      string
+	Method     string
+	IP         string
+	UserAgent  string
+	Start      time.Time
+	TimeFormat string
+	UTC        bool
+}
+
+// NewAccessLog copies the values of r before handlers get a chance to modify them.
+func NewAccessLog(r *http.Request, traceID, ip, timeFormat string, utc bool) *AccessLog {
+	return &AccessLog{
+		TraceID:    traceID,
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		Method:     r.Method,
+		IP:         ip,
+		UserAgent:  r.UserAgent(),
+		Start:      time.Now(),
+		TimeFormat: timeFormat,
+		UTC:        utc,
+	}
+}
+
+// Request logs the request receive entry.
+func (a *AccessLog) Request(ctx context.Context, header http.Header) {
+	xlog.L(ctx).Info("Request receive:",
+		zap.String(string(xtrace.KeyName), a.TraceID),
+		zap.String("path", a.Path),
+		zap.String("method", a.Method),
+		zap.Reflect("header", header),
+		zap.String("query", a.Query),
+		zap.String("ip", a.IP),
+		zap.String("user-agent", a.UserAgent),
+		zap.String("time", a.Start.Format(a.TimeFormat)),
+	)
+}
+
+// Response logs the request response entry with the latency since Start.
+func (a *AccessLog) Response(ctx context.Context, header http.Header, status int, body string) {
+	end := time.Now()
+	latency := end.Sub(a.Start)
+	if a.UTC {
+		end = end.UTC()
+	}
+	xlog.L(ctx).Info("Request response:：",
+		zap.String(string(xtrace.KeyName), a.TraceID),
+		zap.String("path", a.Path),
+		zap.String("method", a.Method),
+		zap.Reflect("header", header),
+		zap.String("query", a.Query),
+		zap.Int("status", status),
+		zap.String("time", end.Format(a.TimeFormat)),
+		zap.Duration("latency", latency),
+		zap.String("body", body),
+	)
+}
+
 // RecoveryWithZap returns a ginzap.HandlerFunc (middleware)
 // that recovers from any panics and logs requests using uber-go/ginzap.
 // All errors are logged using ginzap.Error().
@@ -171,11 +207,18 @@ func RecoveryWithZap(stack bool) gin.HandlerFunc {
 				}
 
 				httpRequest, _ := httputil.DumpRequest(c.Request, false)
+				scheme := "http"
+				if c.Request.TLS != nil {
+					scheme = "https"
+				} else if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+					scheme = proto
+				}
 				if brokenPipe {
 					xlog.L(c.Request.Context()).Error(c.Request.URL.Path,
 						zap.String(string(xtrace.KeyName), traceID),
 						zap.Any("error", err),
 						zap.String("request", string(httpRequest)),
+						zap.String("scheme", scheme),
 					)
 					// If the connection is dead, we can't write a status to it.
 					c.Error(err.(error)) // nolint: errcheck
@@ -189,6 +232,7 @@ func RecoveryWithZap(stack bool) gin.HandlerFunc {
 						zap.Time("time", time.Now()),
 						zap.Any("error", err),
 						zap.String("request", string(httpRequest)),
+						zap.String("scheme", scheme),
 						zap.String("stack", string(debug.Stack())),
 					)
 				} else {
@@ -197,6 +241,7 @@ func RecoveryWithZap(stack bool) gin.HandlerFunc {
 						zap.Time("time", time.Now()),
 						zap.Any("error", err),
 						zap.String("request", string(httpRequest)),
+						zap.String("scheme", scheme),
 					)
 				}
 				c.AbortWithStatus(http.StatusInternalServerError)
@@ -209,5 +254,5 @@ func RecoveryWithZap(stack bool) gin.HandlerFunc {
 
 //GetConnectionNum http connectionNum
 func GetConnectionNum() int64 {
-	return connectionNum
+	return atomic.LoadInt64(&connectionNum)
 }
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/donech/tool/metrics"
+)
+
+const unmatchedRoute = "unmatched"
+
+// Metrics records request count, latency and in-flight requests labeled with
+// the route template, so /user/:id is one series whatever the id is.
+// It must be installed after RecoveryWithZap so that it sees panics first,
+// counts them and passes them on.
+func Metrics(m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		m.HTTPInFlight.Inc()
+		defer m.HTTPInFlight.Dec()
+
+		panicked := true
+		defer func() {
+			status := c.Writer.Status()
+			if panicked {
+				m.Panics.WithLabelValues(metrics.EntryHTTP).Inc()
+				status = 500
+			}
+			route := c.FullPath()
+			if route == "" {
+				route = unmatchedRoute
+			}
+			labels := []string{route, c.Request.Method, strconv.Itoa(status)}
+			m.HTTPRequests.WithLabelValues(labels...).Inc()
+			m.HTTPDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+		}()
+		c.Next()
+		panicked = false
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/donech/tool/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	assert := require.New(t)
+	m := metrics.New("test")
+	engine := gin.New()
+	engine.Use(RecoveryWithZap(false), Metrics(m))
+	engine.GET("/user/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, c.Param("id"))
+	})
+	engine.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	for _, path := range []string{"/user/1", "/user/2", "/panic", "/missing"} {
+		engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	assert.Equal(float64(2), testutil.ToFloat64(m.HTTPRequests.WithLabelValues("/user/:id", "GET", "200")))
+	assert.Equal(float64(1), testutil.ToFloat64(m.HTTPRequests.WithLabelValues("/panic", "GET", "500")))
+	assert.Equal(float64(1), testutil.ToFloat64(m.HTTPRequests.WithLabelValues(unmatchedRoute, "GET", "404")))
+	assert.Equal(float64(1), testutil.ToFloat64(m.Panics.WithLabelValues(metrics.EntryHTTP)))
+	assert.Equal(float64(0), testutil.ToFloat64(m.HTTPInFlight))
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, metrics.DefaultPath, nil))
+	assert.True(strings.Contains(w.Body.String(), `test_http_requests_total{method="GET",route="/user/:id",status="200"} 2`))
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/donech/tool/oidc"
+	"github.com/donech/tool/xlog"
+)
+
+var (
+	oidcStateCookie    = "oidc_state"
+	oidcNonceCookie    = "oidc_nonce"
+	oidcVerifierCookie = "oidc_verifier"
+	// oidcCookieMaxAge how long a login may take at the provider, in seconds.
+	oidcCookieMaxAge = 600
+
+	errOIDCState = errors.New("oidc: state mismatch")
+)
+
+// OIDCLoginHandler redirects the browser to the provider of client. The state,
+// nonce and PKCE verifier are kept in short lived HttpOnly cookies until the
+// callback.
+func (j JWTMiddleware) OIDCLoginHandler(client *oidc.Client) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req, err := oidc.NewAuthRequest()
+		if err != nil {
+			j.errResponseHandler(ctx, j.errorCode, err.Error(), nil)
+			return
+		}
+		j.setOIDCCookie(ctx, oidcStateCookie, req.State, oidcCookieMaxAge)
+		j.setOIDCCookie(ctx, oidcNonceCookie, req.Nonce, oidcCookieMaxAge)
+		j.setOIDCCookie(ctx, oidcVerifierCookie, req.Verifier, oidcCookieMaxAge)
+		ctx.Redirect(http.StatusFound, client.AuthCodeURL(req))
+	}
+}
+
+// OIDCCallbackHandler serves the redirect url of client. It checks the state,
+// redeems the code, verifies the id token, maps its claims through mapper,
+// oidc.DefaultClaimsMapper when nil, and responds with our own token like
+// GenerateTokenHandler does.
+func (j JWTMiddleware) OIDCCallbackHandler(client *oidc.Client, mapper oidc.ClaimsMapper) gin.HandlerFunc {
+	if mapper == nil {
+		mapper = oidc.DefaultClaimsMapper
+	}
+	return func(ctx *gin.Context) {
+		req := oidc.AuthRequest{}
+		req.State, _ = ctx.Cookie(oidcStateCookie)
+		req.Nonce, _ = ctx.Cookie(oidcNonceCookie)
+		req.Verifier, _ = ctx.Cookie(oidcVerifierCookie)
+		for _, name := range []string{oidcStateCookie, oidcNonceCookie, oidcVerifierCookie} {
+			j.setOIDCCookie(ctx, name, "", -1)
+		}
+		if e := ctx.Query("error"); e != "" {
+			j.errResponseHandler(ctx, j.errorCode, "oidc: "+e+" "+ctx.Query("error_description"), nil)
+			return
+		}
+		if req.State == "" || ctx.Query("state") != req.State {
+			j.errResponseHandler(ctx, j.errorCode, errOIDCState.Error(), nil)
+			return
+		}
+		idClaims, err := client.Callback(ctx.Request.Context(), ctx.Query("code"), req)
+		if err != nil {
+			xlog.S(ctx.Request.Context()).Warnf("oidc callback failed: %s", err)
+			j.errResponseHandler(ctx, j.errorCode, err.Error(), nil)
+			return
+		}
+		claims, err := mapper(ctx.Request.Context(), idClaims)
+		if err != nil {
+			j.errResponseHandler(ctx, j.errorCode, err.Error(), nil)
+			return
+		}
+		if j.tokenPair {
+			pair, err := j.factory.GenerateTokenPairWithClaims(claims)
+			if err != nil {
+				j.errResponseHandler(ctx, j.errorCode, err.Error(), nil)
+				return
+			}
+			j.respondPair(ctx, pair)
+			return
+		}
+		token, err := j.factory.GenerateTokenWithClaims(claims)
+		if err != nil {
+			j.errResponseHandler(ctx, j.errorCode, err.Error(), nil)
+			return
+		}
+		j.respondToken(ctx, token)
+	}
+}
+
+// setOIDCCookie sets a flow cookie, it must be sent on the top level redirect
+// back from the provider, hence SameSite lax.
+func (j JWTMiddleware) setOIDCCookie(ctx *gin.Context, name, value string, maxAge int) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   ctx.Request.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if j.cookie != nil {
+		cookie.Domain = j.cookie.Domain
+		cookie.Secure = cookie.Secure || j.cookie.Secure
+	}
+	http.SetCookie(ctx.Writer, cookie)
+}
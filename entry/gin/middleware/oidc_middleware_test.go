@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/donech/tool/oidc"
+	"github.com/donech/tool/oidc/oidctest"
+	"github.com/donech/tool/xjwt"
+)
+
+func TestJWTMiddleware_OIDC(t *testing.T) {
+	assert := require.New(t)
+	provider, err := oidctest.NewProvider("client", "secret")
+	assert.NoError(err)
+	defer provider.Close()
+	client, err := oidc.NewClient(context.Background(), oidc.Config{
+		Issuer:       provider.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://app.example.com/callback",
+	}, nil)
+	assert.NoError(err)
+
+	f, err := xjwt.NewJWTFactory(xjwt.Config{SingingAlgorithm: "HS256", Key: "12312asdasd"})
+	assert.NoError(err)
+	m := NewJWTMiddleware(WithFactory(*f))
+	engine := gin.New()
+	engine.GET("/login", m.OIDCLoginHandler(client))
+	engine.GET("/callback", m.OIDCCallbackHandler(client, func(ctx context.Context, idClaims jwt.MapClaims) (jwt.MapClaims, error) {
+		return jwt.MapClaims{"id": 42, "email": idClaims["email"]}, nil
+	}))
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+	assert.Equal(http.StatusFound, w.Code)
+	cookies := w.Result().Cookies()
+	assert.Len(cookies, 3)
+
+	// the provider approves and redirects back with code and state
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := noRedirect.Get(w.Header().Get("Location"))
+	assert.NoError(err)
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	assert.NoError(err)
+
+	call := func(query string) gin.H {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/callback?"+query, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		engine.ServeHTTP(w, req)
+		resp := gin.H{}
+		assert.NoError(json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+	forged := callback.Query()
+	forged.Set("state", "forged")
+	assert.Equal(float64(errCode), call(forged.Encode())["code"])
+
+	result := call(callback.RawQuery)
+	assert.Equal(float64(0), result["code"], result)
+	token, _ := result["data"].(map[string]interface{})["token"].(string)
+	claims, err := f.GetClaims(token)
+	assert.NoError(err)
+	assert.Equal(float64(42), claims["id"])
+	assert.Equal("user@example.com", claims["email"])
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/donech/tool/ratelimit"
+	"github.com/donech/tool/xjwt"
+	"github.com/donech/tool/xlog"
+)
+
+// RateLimitKeyFunc returns the key a request is limited by.
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// RateLimitByIP limits by client ip.
+func RateLimitByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimitByRoute limits by method and route template, all clients share the quota.
+func RateLimitByRoute(c *gin.Context) string {
+	return "route:" + c.Request.Method + " " + c.FullPath()
+}
+
+// RateLimitByClaim limits by a jwt claim set by JWTMiddleware.MiddleWareImpl,
+// such as id, and falls back to the client ip for anonymous requests.
+func RateLimitByClaim(name string) RateLimitKeyFunc {
+	return func(c *gin.Context) string {
+		if v, ok := xjwt.GetClaimsFromCtx(c.Request.Context())[name]; ok {
+			return "claim:" + name + ":" + fmt.Sprint(v)
+		}
+		return RateLimitByIP(c)
+	}
+}
+
+// RateLimit rejects requests over the limit with 429 and a Retry-After header.
+// Requests are let through when the limiter itself fails, e.g. redis is down.
+func RateLimit(limiter ratelimit.Limiter, key RateLimitKeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, err := limiter.Allow(c.Request.Context(), key(c))
+		if err != nil {
+			xlog.S(c.Request.Context()).Errorf("rate limit error: %s", err)
+			c.Next()
+			return
+		}
+		c.Header("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		if res.Allowed {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"code": http.StatusTooManyRequests,
+			"msg":  "too many requests",
+			"data": nil,
+		})
+	}
+}
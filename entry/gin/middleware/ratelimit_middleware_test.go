@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/donech/tool/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	assert := require.New(t)
+	engine := gin.New()
+	engine.Use(RateLimit(ratelimit.NewTokenBucket(1, time.Minute, 1), RateLimitByIP))
+	engine.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+
+	request := func(ip string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		r.RemoteAddr = ip + ":1234"
+		engine.ServeHTTP(w, r)
+		return w
+	}
+	assert.Equal(http.StatusOK, request("10.0.0.1").Code)
+	w := request("10.0.0.1")
+	assert.Equal(http.StatusTooManyRequests, w.Code)
+	assert.Equal("60", w.Header().Get("Retry-After"))
+	assert.Equal("0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.JSONEq(`{"code":429,"msg":"too many requests","data":null}`, w.Body.String())
+	assert.Equal(http.StatusOK, request("10.0.0.2").Code)
+}
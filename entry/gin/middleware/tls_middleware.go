@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"github.com/donech/tool/xtls"
+	"github.com/gin-gonic/gin"
+)
+
+// PeerIdentity puts the verified client certificate of a mutual TLS
+// connection into the request context, see xtls.GetIdentityFromCtx.
+func PeerIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if identity, ok := xtls.IdentityFromRequest(c.Request); ok {
+			c.Request = c.Request.WithContext(xtls.SetIdentityToCtx(c.Request.Context(), identity))
+		}
+		c.Next()
+	}
+}
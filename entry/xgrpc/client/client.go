@@ -0,0 +1,129 @@
+// Package client dials grpc services with interceptors that propagate the
+// trace id and the authorization token, and log every call.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/donech/tool/xtls"
+)
+
+type Option func(c *options)
+
+type options struct {
+	tokenSource TokenSource
+	dialOptions []grpc.DialOption
+}
+
+// WithTokenSource sets where the outgoing authorization token comes from,
+// it takes precedence over Config.ForwardToken.
+func WithTokenSource(source TokenSource) Option {
+	return func(c *options) {
+		c.tokenSource = source
+	}
+}
+
+// WithDialOptions appends raw grpc dial options.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(c *options) {
+		c.dialOptions = append(c.dialOptions, opts...)
+	}
+}
+
+// Dial creates a client connection to conf.Target with trace id, token,
+// deadline and logging interceptors and the retry policy from conf.
+func Dial(ctx context.Context, conf Config, opts ...Option) (*grpc.ClientConn, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.tokenSource == nil && conf.ForwardToken {
+		o.tokenSource = ForwardTokenSource
+	}
+
+	traceIdInterceptor := TraceIdInterceptor{}
+	timeoutInterceptor := TimeoutInterceptor{Timeout: conf.Timeout}
+	tokenInterceptor := TokenInterceptor{Source: o.tokenSource}
+	logInterceptor := LogInterceptor{}
+	transport := grpc.WithInsecure()
+	if conf.TLS.Enabled() {
+		tlsConfig, err := xtls.LoadClientConfig(conf.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
+	}
+	dialOptions := []grpc.DialOption{
+		transport,
+		grpc.WithUnaryInterceptor(grpc_middleware.ChainUnaryClient(
+			traceIdInterceptor.Unary,
+			timeoutInterceptor.Unary,
+			tokenInterceptor.Unary,
+			logInterceptor.Unary,
+		)),
+		grpc.WithStreamInterceptor(grpc_middleware.ChainStreamClient(
+			traceIdInterceptor.Stream,
+			tokenInterceptor.Stream,
+			logInterceptor.Stream,
+		)),
+	}
+	serviceConfig, err := conf.Retry.serviceConfig()
+	if err != nil {
+		return nil, err
+	}
+	if serviceConfig != "" {
+		dialOptions = append(dialOptions, grpc.WithDefaultServiceConfig(serviceConfig))
+	}
+	dialOptions = append(dialOptions, o.dialOptions...)
+	return grpc.DialContext(ctx, conf.Target, dialOptions...)
+}
+
+// serviceConfig renders the retry policy as a grpc service config applying to all methods.
+func (c RetryConfig) serviceConfig() (string, error) {
+	if c.MaxAttempts < 2 {
+		return "", nil
+	}
+	initialBackoff := c.InitialBackoff
+	if initialBackoff <= 0 {
+		initialBackoff = 100 * time.Millisecond
+	}
+	maxBackoff := c.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = time.Second
+	}
+	multiplier := c.BackoffMultiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	codes := c.RetryableStatusCodes
+	if len(codes) == 0 {
+		codes = []string{"UNAVAILABLE"}
+	}
+	config := map[string]interface{}{
+		"methodConfig": []interface{}{
+			map[string]interface{}{
+				"name": []interface{}{map[string]interface{}{}},
+				"retryPolicy": map[string]interface{}{
+					"maxAttempts":          c.MaxAttempts,
+					"initialBackoff":       durationString(initialBackoff),
+					"maxBackoff":           durationString(maxBackoff),
+					"backoffMultiplier":    multiplier,
+					"retryableStatusCodes": codes,
+				},
+			},
+		},
+	}
+	b, err := json.Marshal(config)
+	return string(b), err
+}
+
+func durationString(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/donech/tool/xjwt"
+	"github.com/donech/tool/xtls"
+	"github.com/donech/tool/xtrace"
+)
+
+func newServer(t *testing.T, incoming chan<- metadata.MD) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		_, hasDeadline := ctx.Deadline()
+		if hasDeadline {
+			md = metadata.Join(md, metadata.Pairs("has-deadline", "true"))
+		}
+		incoming <- md
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(l)
+	t.Cleanup(srv.Stop)
+	return l.Addr().String()
+}
+
+func TestDial(t *testing.T) {
+	assert := require.New(t)
+	incoming := make(chan metadata.MD, 1)
+	addr := newServer(t, incoming)
+
+	conn, err := Dial(context.Background(), Config{Target: addr, Timeout: time.Second, ForwardToken: true})
+	assert.NoError(err)
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	ctx := context.WithValue(context.Background(), xtrace.KeyName, "trace-1")
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(headerAuthorize, "caller-token"))
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.NoError(err)
+	md := <-incoming
+	assert.Equal("trace-1", xtrace.GetTraceIDFromGrpcMetadata(md))
+	assert.Equal([]string{"caller-token"}, md.Get(headerAuthorize))
+	assert.Equal([]string{"true"}, md.Get("has-deadline"))
+
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(err)
+	md = <-incoming
+	assert.NotEmpty(xtrace.GetTraceIDFromGrpcMetadata(md))
+	assert.Empty(md.Get(headerAuthorize))
+}
+
+func TestServiceTokenSource(t *testing.T) {
+	assert := require.New(t)
+	factory, err := xjwt.NewJWTFactory(xjwt.Config{SingingAlgorithm: "HS256", Key: "client-test", Timeout: "10m"},
+		xjwt.WithLoginFunc(func(ctx context.Context, form xjwt.LoginForm) (jwt.MapClaims, error) {
+			return jwt.MapClaims{}, nil
+		}))
+	assert.NoError(err)
+	incoming := make(chan metadata.MD, 1)
+	addr := newServer(t, incoming)
+
+	source := ServiceTokenSource(factory, jwt.MapClaims{"service": "order"})
+	conn, err := Dial(context.Background(), Config{Target: addr}, WithTokenSource(source))
+	assert.NoError(err)
+	defer conn.Close()
+
+	_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(err)
+	md := <-incoming
+	assert.Empty(md.Get("has-deadline"))
+	claims, err := factory.GetClaims(md.Get(headerAuthorize)[0])
+	assert.NoError(err)
+	assert.Equal("order", claims["service"])
+
+	again, err := source(context.Background())
+	assert.NoError(err)
+	assert.Equal(md.Get(headerAuthorize)[0], again)
+}
+
+func TestRetryConfig_serviceConfig(t *testing.T) {
+	assert := require.New(t)
+	sc, err := RetryConfig{}.serviceConfig()
+	assert.NoError(err)
+	assert.Empty(sc)
+
+	sc, err = RetryConfig{MaxAttempts: 3, InitialBackoff: 50 * time.Millisecond}.serviceConfig()
+	assert.NoError(err)
+	assert.JSONEq(`{"methodConfig":[{"name":[{}],"retryPolicy":{"maxAttempts":3,"initialBackoff":"0.05s","maxBackoff":"1s","backoffMultiplier":2,"retryableStatusCodes":["UNAVAILABLE"]}}]}`, sc)
+
+	conn, err := Dial(context.Background(), Config{Target: "127.0.0.1:1", Retry: RetryConfig{MaxAttempts: 3}})
+	assert.NoError(err)
+	conn.Close()
+}
+
+func TestDial_TLS(t *testing.T) {
+	assert := require.New(t)
+	_, err := Dial(context.Background(), Config{Target: "127.0.0.1:1", TLS: xtls.Config{CAFile: "missing.pem"}})
+	assert.Error(err)
+}
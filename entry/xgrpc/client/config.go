@@ -0,0 +1,33 @@
+package client
+
+import (
+	"time"
+
+	"github.com/donech/tool/xtls"
+)
+
+type Config struct {
+	// Target grpc dial target, e.g. 127.0.0.1:9090 or dns:///user-service:9090
+	Target string `yaml:"target"`
+	// Timeout default deadline of unary calls whose context has none, 0 means no deadline.
+	Timeout time.Duration `yaml:"timeout"`
+	// ForwardToken forwards the incoming authorization metadata of the caller.
+	ForwardToken bool `yaml:"forwardToken"`
+	// Retry retry policy applied to every method through the service config.
+	Retry RetryConfig `yaml:"retry"`
+	// TLS dials over TLS when a CA or certificate is configured, the certificate is presented for mutual TLS.
+	TLS xtls.Config `yaml:"tls"`
+}
+
+type RetryConfig struct {
+	// MaxAttempts including the original call, retry is disabled when it is less than 2.
+	MaxAttempts int `yaml:"maxAttempts"`
+	// InitialBackoff default 100ms.
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	// MaxBackoff default 1s.
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+	// BackoffMultiplier default 2.
+	BackoffMultiplier float64 `yaml:"backoffMultiplier"`
+	// RetryableStatusCodes grpc code names, default UNAVAILABLE.
+	RetryableStatusCodes []string `yaml:"retryableStatusCodes"`
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/donech/tool/xlog"
+	"github.com/donech/tool/xtrace"
+)
+
+// TraceIdInterceptor puts the trace id of the context into the outgoing
+// metadata, generating one when the context has none.
+type TraceIdInterceptor struct{}
+
+func (i *TraceIdInterceptor) Unary(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(i.outgoing(ctx), method, req, reply, cc, opts...)
+}
+
+func (i *TraceIdInterceptor) Stream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(i.outgoing(ctx), desc, cc, method, opts...)
+}
+
+func (i *TraceIdInterceptor) outgoing(ctx context.Context) context.Context {
+	ctx = xtrace.NewCtxWithTraceID(ctx)
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if xtrace.GetTraceIDFromGrpcMetadata(md) != "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, string(xtrace.KeyName), xtrace.GetTraceIDFromContext(ctx))
+}
+
+// TimeoutInterceptor applies Timeout to unary calls whose context has no deadline.
+// Streams are left alone since they are usually long lived.
+type TimeoutInterceptor struct {
+	Timeout time.Duration
+}
+
+func (i *TimeoutInterceptor) Unary(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if _, ok := ctx.Deadline(); ok || i.Timeout <= 0 {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	ctx, cancel := context.WithTimeout(ctx, i.Timeout)
+	defer cancel()
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// TokenInterceptor sets the authorization metadata from Source, it does
+// nothing when Source is nil or returns an empty token.
+type TokenInterceptor struct {
+	Source TokenSource
+}
+
+func (i *TokenInterceptor) Unary(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, err := i.outgoing(ctx)
+	if err != nil {
+		return err
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func (i *TokenInterceptor) Stream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx, err := i.outgoing(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return streamer(ctx, desc, cc, method, opts...)
+}
+
+func (i *TokenInterceptor) outgoing(ctx context.Context) (context.Context, error) {
+	if i.Source == nil {
+		return ctx, nil
+	}
+	token, err := i.Source(ctx)
+	if err != nil {
+		xlog.S(ctx).Errorf("get grpc client token error: %s", err)
+		return ctx, err
+	}
+	if token == "" {
+		return ctx, nil
+	}
+	return metadata.AppendToOutgoingContext(ctx, headerAuthorize, token), nil
+}
+
+// LogInterceptor logs requests and responses through xlog.L(ctx).
+type LogInterceptor struct{}
+
+func (i *LogInterceptor) Unary(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	xlog.L(ctx).Info("outgoing grpc req", zap.String("method", method), zap.String("target", cc.Target()), zap.Reflect("req", req))
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	xlog.L(ctx).Info("incoming grpc resp",
+		zap.String("method", method),
+		zap.Reflect("resp", reply),
+		zap.Duration("latency", time.Since(start)),
+		zap.Error(err),
+	)
+	return err
+}
+
+func (i *LogInterceptor) Stream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	xlog.L(ctx).Info("outgoing grpc stream", zap.String("method", method), zap.String("target", cc.Target()))
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		xlog.L(ctx).Info("outgoing grpc stream failed", zap.String("method", method), zap.Error(err))
+	}
+	return stream, err
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/grpc-ecosystem/go-grpc-middleware/util/metautils"
+
+	"github.com/donech/tool/xjwt"
+)
+
+var headerAuthorize = "authorization"
+
+// TokenSource returns the authorization token of an outgoing call.
+type TokenSource func(ctx context.Context) (string, error)
+
+// ForwardTokenSource forwards the authorization metadata the caller received.
+func ForwardTokenSource(ctx context.Context) (string, error) {
+	return metautils.ExtractIncoming(ctx).Get(headerAuthorize), nil
+}
+
+// ServiceTokenSource mints a token for claims through factory and reuses it
+// until half of its lifetime has passed.
+func ServiceTokenSource(factory *xjwt.JWTFactory, claims jwt.MapClaims) TokenSource {
+	var (
+		mu       sync.Mutex
+		token    string
+		expireAt time.Time
+	)
+	return func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if token != "" && time.Now().Before(expireAt) {
+			return token, nil
+		}
+		c := make(jwt.MapClaims, len(claims))
+		for k, v := range claims {
+			c[k] = v
+		}
+		t, err := factory.GenerateTokenWithClaims(c)
+		if err != nil {
+			return "", err
+		}
+		token, expireAt = t, time.Now().Add(factory.Timeout()/2)
+		return token, nil
+	}
+}
@@ -1,9 +1,19 @@
 package xgrpc
 
+import "github.com/donech/tool/xtls"
+
 type Config struct {
 	Addr          string `yaml:"addr"`
 	Port          string `yaml:"port"`
 	WebPort       string `yaml:"webPort"`
 	EnableReflect bool   `yaml:"enableReflect"`
 	EnableGateWay bool   `yaml:"enableGateWay"`
+	// AdminPort http port serving metrics and health probes, disabled when empty.
+	AdminPort string `yaml:"adminPort"`
+	// MetricsPath path serving metrics on AdminPort, default /metrics.
+	MetricsPath string `yaml:"metricsPath"`
+	// TLS serves grpc and the gateway over TLS when a certificate is configured,
+	// clients are verified when ClientAuth is set. The gateway dials the grpc
+	// server with the same certificate, so it must also allow client auth usage.
+	TLS xtls.Config `yaml:"tls"`
 }
@@ -3,11 +3,19 @@ package xgrpc
 import (
 	"context"
 	"net"
+	"net/http"
+	"sync"
 
+	"github.com/donech/tool/authz"
+	"github.com/donech/tool/health"
+	"github.com/donech/tool/metrics"
+	"github.com/donech/tool/ratelimit"
 	"github.com/donech/tool/xjwt"
 	"github.com/donech/tool/xlog"
+	"github.com/donech/tool/xtls"
 
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/reflect/protoreflect"
 
 	"github.com/donech/tool/entry/xgrpc/interceptor"
 
@@ -17,11 +25,14 @@ import (
 	"github.com/opentracing/opentracing-go"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func New(config Config, options ...Option) *Entry {
 	en := &Entry{
 		config: config,
+		done:   make(chan struct{}),
 	}
 	for _, option := range options {
 		option(en)
@@ -49,38 +60,154 @@ func WithJwtFactory(jwtFactory *xjwt.JWTFactory) Option {
 	}
 }
 
+// WithJumpMethods sets the public methods, keys may be glob patterns like /pkg.Service/*.
 func WithJumpMethods(jumps map[string]bool) Option {
 	return func(entry *Entry) {
 		entry.jumpMethods = jumps
 	}
 }
 
+// WithAuthenticators authenticates calls without a jwt token, e.g. by api key
+// or client certificate, see interceptor.Authenticator.
+func WithAuthenticators(authenticators ...interceptor.Authenticator) Option {
+	return func(entry *Entry) {
+		entry.authenticators = append(entry.authenticators, authenticators...)
+	}
+}
+
+// WithPublicOption makes the methods whose options set the bool extension ext public.
+func WithPublicOption(ext protoreflect.ExtensionType) Option {
+	return func(entry *Entry) {
+		entry.publicOption = ext
+	}
+}
+
+// WithAuthorizer checks the method permissions of rbac after authentication.
+func WithAuthorizer(rbac *authz.RBAC) Option {
+	return func(entry *Entry) {
+		entry.authorizer = rbac
+	}
+}
+
+// WithHealth registers the grpc.health.v1.Health service backed by registry,
+// readiness flips to NOT_SERVING as soon as Stop begins.
+func WithHealth(registry *health.Registry) Option {
+	return func(entry *Entry) {
+		entry.health = registry
+	}
+}
+
+// WithMetrics records call metrics, they are served on Config.AdminPort.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(entry *Entry) {
+		entry.metrics = m
+	}
+}
+
+// WithRateLimit rejects calls over limiter with codes.ResourceExhausted, calls
+// are keyed by key after authentication, nil keys by peer address.
+func WithRateLimit(limiter ratelimit.Limiter, key interceptor.RateLimitKeyFunc) Option {
+	return func(entry *Entry) {
+		entry.rateLimiter = limiter
+		entry.rateLimitKey = key
+	}
+}
+
 type RegisteServer func(server *grpc.Server)
 type RegisteWebHandler func(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error
 
 type Entry struct {
 	config            Config
 	srv               *grpc.Server
+	listener          net.Listener
 	registeServer     RegisteServer
 	registeWebHandler RegisteWebHandler
 	jwtFactory        *xjwt.JWTFactory
 	jumpMethods       map[string]bool
+	authenticators    []interceptor.Authenticator
+	publicOption      protoreflect.ExtensionType
+	authorizer        *authz.RBAC
+	rateLimiter       ratelimit.Limiter
+	rateLimitKey      interceptor.RateLimitKeyFunc
+	health            *health.Registry
+	metrics           *metrics.Metrics
+	tls               *xtls.Reloader
+	admin             *http.Server
+	gateway           *http.Server
+	gatewayConn       *grpc.ClientConn
+	gatewayCancel     context.CancelFunc
+	once              sync.Once
+	done              chan struct{}
+	err               error
 }
 
+// Run binds the listener synchronously so that bind failures are returned,
+// then serves in the background. Later serve failures are reported through
+// Done and Err.
 func (e *Entry) Run() error {
 	traceIdInterceptor := interceptor.TraceIdInterceptor{}
+	recoveryInterceptor := interceptor.RecoveryInterceptor{}
 	logInterceptor := interceptor.LogInterceptor{}
-	JwtInterceptor := interceptor.NewJwtInterceptor(e.jwtFactory, e.jumpMethods)
-	srv := grpc.NewServer(
-		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
-			traceIdInterceptor.Serve,
-			grpcopentracing.UnaryServerInterceptor(grpcopentracing.WithTracer(opentracing.GlobalTracer())),
-			logInterceptor.Serve,
-			JwtInterceptor.Serve,
-		)))
+	tracer := grpcopentracing.WithTracer(opentracing.GlobalTracer())
+	unary := []grpc.UnaryServerInterceptor{traceIdInterceptor.Serve, recoveryInterceptor.Serve}
+	stream := []grpc.StreamServerInterceptor{traceIdInterceptor.StreamServe, recoveryInterceptor.StreamServe}
+	serverOptions := make([]grpc.ServerOption, 0, 3)
+	if e.config.TLS.Enabled() {
+		reloader, err := xtls.NewReloader(e.config.TLS)
+		if err != nil {
+			xlog.SS().Errorf("load tls certificate error: %s", err)
+			return err
+		}
+		e.tls = reloader
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(reloader.ServerConfig())))
+		if e.config.TLS.ClientAuth {
+			peerIdentityInterceptor := interceptor.PeerIdentityInterceptor{}
+			unary = append(unary, peerIdentityInterceptor.Serve)
+			stream = append(stream, peerIdentityInterceptor.StreamServe)
+		}
+	}
+	if e.metrics != nil {
+		metricsInterceptor := interceptor.MetricsInterceptor{Metrics: e.metrics}
+		unary = append(unary, metricsInterceptor.Serve)
+		stream = append(stream, metricsInterceptor.StreamServe)
+	}
+	unary = append(unary,
+		grpcopentracing.UnaryServerInterceptor(tracer),
+		logInterceptor.Serve,
+	)
+	stream = append(stream,
+		grpcopentracing.StreamServerInterceptor(tracer),
+		logInterceptor.StreamServe,
+	)
+	if e.authenticates() {
+		if e.jwtFactory == nil && len(e.authenticators) == 0 {
+			xlog.SS().Warn("grpc entry has no jwt factory or authenticators, only public methods can be called")
+		}
+		jwtInterceptor := interceptor.NewJwtInterceptor(e.jwtFactory, e.publicMethods(),
+			interceptor.WithPublicOption(e.publicOption), interceptor.WithAuthenticators(e.authenticators...))
+		unary = append(unary, jwtInterceptor.Serve)
+		stream = append(stream, jwtInterceptor.StreamServe)
+	}
+	if e.authorizer != nil {
+		authzInterceptor := interceptor.AuthzInterceptor{RBAC: e.authorizer}
+		unary = append(unary, authzInterceptor.Serve)
+		stream = append(stream, authzInterceptor.StreamServe)
+	}
+	if e.rateLimiter != nil {
+		rateLimitInterceptor := &interceptor.RateLimitInterceptor{Limiter: e.rateLimiter, Key: e.rateLimitKey}
+		unary = append(unary, rateLimitInterceptor.Serve)
+		stream = append(stream, rateLimitInterceptor.StreamServe)
+	}
+	serverOptions = append(serverOptions,
+		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(unary...)),
+		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(stream...)),
+	)
+	srv := grpc.NewServer(serverOptions...)
 	if e.registeServer != nil {
 		e.registeServer(srv)
-		e.srv = srv
+	}
+	if e.health != nil {
+		healthpb.RegisterHealthServer(srv, newHealthServer(e.health))
 	}
 	if e.config.EnableReflect {
 		xlog.SS().Info("enable grpc reflect")
@@ -89,20 +216,149 @@ func (e *Entry) Run() error {
 	listen, err := net.Listen("tcp", e.config.Port)
 	if err != nil {
 		xlog.SS().Errorf("listen tcp error: %s", err)
+		e.closeTLS()
 		return err
 	}
 	xlog.SS().Infof("listening tcp port: %s", e.config.Port)
+	e.srv = srv
+	e.listener = listen
 
 	go func() {
 		xlog.SS().Info("start grpc server at ", e.config.Port)
-		if err = srv.Serve(listen); err != nil {
-			xlog.SS().Fatalf("grpc serve listen error: %s", err)
+		err := srv.Serve(listen)
+		if err != nil && err != grpc.ErrServerStopped {
+			xlog.SS().Errorf("grpc serve listen error: %s", err)
+			e.exit(err)
+			return
 		}
+		e.exit(nil)
 	}()
+
+	if err := e.runGateway(); err != nil {
+		xlog.SS().Errorf("start grpc gateway error: %s", err)
+		e.stopGateway(context.Background())
+		srv.Stop()
+		e.closeTLS()
+		return err
+	}
+	if err := e.runAdmin(); err != nil {
+		xlog.SS().Errorf("start grpc admin error: %s", err)
+		e.stopGateway(context.Background())
+		srv.Stop()
+		e.closeTLS()
+		return err
+	}
 	return nil
 }
 
-func (e *Entry) Stop(ctx context.Context) error {
-	e.srv.GracefulStop()
+// runAdmin serves metrics and health probes on AdminPort.
+func (e *Entry) runAdmin() error {
+	if e.config.AdminPort == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	if e.metrics != nil {
+		path := e.config.MetricsPath
+		if path == "" {
+			path = metrics.DefaultPath
+		}
+		mux.Handle(path, e.metrics.Handler())
+	}
+	if e.health != nil {
+		health.Mount(mux, e.health)
+	}
+	listen, err := net.Listen("tcp", e.config.AdminPort)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: mux}
+	e.admin = srv
+	go func() {
+		xlog.SS().Info("start grpc admin at ", e.config.AdminPort)
+		if err := srv.Serve(listen); err != nil && err != http.ErrServerClosed {
+			xlog.SS().Errorf("grpc admin serve error: %s", err)
+			e.exit(err)
+		}
+	}()
 	return nil
 }
+
+// publicMethods adds the health and reflection services to the jump methods,
+// probes and tooling call them without credentials.
+// authenticates reports whether calls are authenticated, any auth option turns
+// it on so that a missing authenticator rejects calls instead of skipping auth.
+func (e *Entry) authenticates() bool {
+	return e.jwtFactory != nil || len(e.authenticators) > 0 || len(e.jumpMethods) > 0 ||
+		e.publicOption != nil || e.authorizer != nil
+}
+
+func (e *Entry) publicMethods() map[string]bool {
+	jumps := make(map[string]bool, len(e.jumpMethods)+2)
+	for method, jump := range e.jumpMethods {
+		jumps[method] = jump
+	}
+	if e.health != nil {
+		jumps["/grpc.health.v1.Health/*"] = true
+	}
+	if e.config.EnableReflect {
+		jumps["/grpc.reflection.v1alpha.ServerReflection/*"] = true
+	}
+	return jumps
+}
+
+func (e *Entry) closeTLS() {
+	if e.tls != nil {
+		e.tls.Close()
+	}
+}
+
+// exit records the first serve loop result and closes Done.
+func (e *Entry) exit(err error) {
+	e.once.Do(func() {
+		e.err = err
+		close(e.done)
+	})
+}
+
+// Done is closed when the grpc serve loop exits or the gateway fails.
+func (e *Entry) Done() <-chan struct{} {
+	return e.done
+}
+
+// Err returns the serve failure once Done is closed, nil otherwise.
+func (e *Entry) Err() error {
+	select {
+	case <-e.done:
+		return e.err
+	default:
+		return nil
+	}
+}
+
+func (e *Entry) Stop(ctx context.Context) error {
+	if e.srv == nil {
+		return nil
+	}
+	if e.health != nil {
+		e.health.Drain(ctx)
+	}
+	if err := e.stopGateway(ctx); err != nil {
+		xlog.SS().Errorf("grpc gateway shutdown error: %s", err)
+	}
+	if e.admin != nil {
+		defer e.admin.Close()
+	}
+	defer e.closeTLS()
+	stopped := make(chan struct{})
+	go func() {
+		e.srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		e.srv.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,296 @@
+package xgrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/utilities"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/donech/tool/authz"
+	"github.com/donech/tool/health"
+	"github.com/donech/tool/metrics"
+	"github.com/donech/tool/ratelimit"
+	"github.com/donech/tool/xtls"
+	"github.com/donech/tool/xtls/xtlstest"
+	"github.com/donech/tool/xtrace"
+)
+
+func TestEntry_RunAddressInUse(t *testing.T) {
+	assert := require.New(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer l.Close()
+
+	e := New(Config{Port: l.Addr().String()})
+	assert.Error(e.Run())
+	assert.NoError(e.Stop(context.Background()))
+}
+
+func TestEntry_RunAndStop(t *testing.T) {
+	assert := require.New(t)
+	e := New(Config{Port: "127.0.0.1:0"})
+	assert.NoError(e.Run())
+	assert.NoError(e.Err())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(e.Stop(ctx))
+	<-e.Done()
+	assert.NoError(e.Err())
+}
+
+func TestEntry_Health(t *testing.T) {
+	assert := require.New(t)
+	registry := health.NewRegistry()
+	e := New(Config{Port: "127.0.0.1:0"}, WithHealth(registry))
+	assert.NoError(e.Run())
+
+	conn, err := grpc.Dial(e.listener.Addr().String(), grpc.WithInsecure())
+	assert.NoError(err)
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(err)
+	assert.Equal(healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "db"})
+	assert.Equal(codes.NotFound, status.Code(err))
+
+	registry.Shutdown()
+	resp, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(err)
+	assert.Equal(healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+	assert.NoError(e.Stop(context.Background()))
+}
+
+func TestEntry_AuthWithoutAuthenticator(t *testing.T) {
+	assert := require.New(t)
+	rbac, err := authz.New(authz.Policy{Methods: map[string][]string{"/grpc.health.v1.Health/Watch": {"health:watch"}}})
+	assert.NoError(err)
+	for _, opt := range []Option{
+		WithJumpMethods(map[string]bool{"/grpc.health.v1.Health/Watch": true}),
+		WithAuthorizer(rbac),
+	} {
+		e := New(Config{Port: "127.0.0.1:0"}, opt, WithRegisteServer(func(server *grpc.Server) {
+			healthpb.RegisterHealthServer(server, grpchealth.NewServer())
+		}))
+		assert.NoError(e.Run())
+		conn, err := grpc.Dial(e.listener.Addr().String(), grpc.WithInsecure())
+		assert.NoError(err)
+		_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		assert.Equal(codes.Unauthenticated, status.Code(err))
+		assert.NoError(conn.Close())
+		assert.NoError(e.Stop(context.Background()))
+	}
+}
+
+func TestEntry_RateLimit(t *testing.T) {
+	assert := require.New(t)
+	e := New(Config{Port: "127.0.0.1:0"},
+		WithHealth(health.NewRegistry()),
+		WithRateLimit(ratelimit.NewTokenBucket(1, time.Minute, 1), nil))
+	assert.NoError(e.Run())
+	defer e.Stop(context.Background())
+
+	conn, err := grpc.Dial(e.listener.Addr().String(), grpc.WithInsecure())
+	assert.NoError(err)
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(err)
+
+	var trailer metadata.MD
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{}, grpc.Trailer(&trailer))
+	assert.Equal(codes.ResourceExhausted, status.Code(err))
+	assert.Equal([]string{"60"}, trailer.Get("retry-after"))
+}
+
+func TestEntry_Gateway(t *testing.T) {
+	assert := require.New(t)
+	e := New(
+		Config{Port: "127.0.0.1:0", WebPort: "127.0.0.1:0", EnableGateWay: true},
+		WithHealth(health.NewRegistry()),
+		WithRegisteWebHandler(registeHealthWebHandler),
+	)
+	assert.NoError(e.Run())
+	defer e.Stop(context.Background())
+
+	srv := httptest.NewServer(e.gateway.Handler)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/check", nil)
+	req.Header.Set(string(xtrace.KeyName), "trace-1")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("trace-1", resp.Header.Get(string(xtrace.KeyName)))
+	assert.JSONEq(`{"status":"SERVING"}`, string(body))
+
+	resp, err = http.Get(srv.URL + "/check?service=db")
+	assert.NoError(err)
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	assert.NotEmpty(resp.Header.Get(string(xtrace.KeyName)))
+	assert.JSONEq(`{"code":5,"msg":"unknown service db","data":null}`, string(body))
+}
+
+func TestGatewayLogWriter_Truncate(t *testing.T) {
+	assert := require.New(t)
+	rec := httptest.NewRecorder()
+	w := &gatewayLogWriter{ResponseWriter: rec, status: http.StatusOK, body: bytes.NewBufferString("")}
+	chunk := bytes.Repeat([]byte("a"), 600)
+	for i := 0; i < 3; i++ {
+		_, err := w.Write(chunk)
+		assert.NoError(err)
+	}
+	assert.Equal(1800, rec.Body.Len())
+	assert.Equal(maxGatewayBodyLog, w.body.Len())
+	assert.Equal(strings.Repeat("a", maxGatewayBodyLog)+truncatedMarker, w.loggedBody())
+}
+
+func TestGatewayIncomingHeaderMatcher(t *testing.T) {
+	assert := require.New(t)
+	mux := runtime.NewServeMux(runtime.WithIncomingHeaderMatcher(gatewayIncomingHeaderMatcher))
+	req := httptest.NewRequest(http.MethodGet, "/check", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set(string(xtrace.KeyName), "trace-1")
+	ctx, err := runtime.AnnotateContext(context.Background(), mux, req)
+	assert.NoError(err)
+	md, _ := metadata.FromOutgoingContext(ctx)
+	assert.Equal([]string{"Bearer token"}, md.Get("authorization"))
+	assert.Equal([]string{"trace-1"}, md.Get(string(xtrace.KeyName)))
+}
+
+func TestEntry_Admin(t *testing.T) {
+	assert := require.New(t)
+	e := New(
+		Config{Port: "127.0.0.1:0", AdminPort: "127.0.0.1:0"},
+		WithHealth(health.NewRegistry()),
+		WithMetrics(metrics.New("test")),
+	)
+	assert.NoError(e.Run())
+	defer e.Stop(context.Background())
+
+	conn, err := grpc.Dial(e.listener.Addr().String(), grpc.WithInsecure())
+	assert.NoError(err)
+	defer conn.Close()
+	_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(err)
+
+	for path, expect := range map[string]string{
+		metrics.DefaultPath:  `test_grpc_server_handled_total{code="OK",method="/grpc.health.v1.Health/Check"} 1`,
+		health.ReadinessPath: `{"status":"up"}`,
+	} {
+		w := httptest.NewRecorder()
+		e.admin.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(http.StatusOK, w.Code)
+		assert.Contains(w.Body.String(), expect)
+	}
+}
+
+// identityHealthServer reports SERVING to the client identified by its certificate only.
+type identityHealthServer struct {
+	healthpb.UnimplementedHealthServer
+}
+
+func (identityHealthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	identity, ok := xtls.GetIdentityFromCtx(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "no client certificate")
+	}
+	if req.Service != "" && req.Service != identity.CommonName {
+		return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}, nil
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func TestEntry_MutualTLS(t *testing.T) {
+	assert := require.New(t)
+	dir, err := ioutil.TempDir("", "xgrpc")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	ca, err := xtlstest.NewCA(dir)
+	assert.NoError(err)
+	serverConf, err := ca.Issue(dir, "server", 2)
+	assert.NoError(err)
+	serverConf.ClientAuth = true
+	clientConf, err := ca.Issue(dir, "client", 3)
+	assert.NoError(err)
+
+	e := New(
+		Config{Port: "127.0.0.1:0", WebPort: "127.0.0.1:0", EnableGateWay: true, TLS: serverConf},
+		WithRegisteServer(func(server *grpc.Server) {
+			healthpb.RegisterHealthServer(server, identityHealthServer{})
+		}),
+		WithRegisteWebHandler(registeHealthWebHandler),
+	)
+	assert.NoError(e.Run())
+	defer e.Stop(context.Background())
+
+	tlsConfig, err := xtls.LoadClientConfig(clientConf)
+	assert.NoError(err)
+	tlsConfig.ServerName = "localhost"
+	conn, err := grpc.Dial(e.listener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	assert.NoError(err)
+	defer conn.Close()
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{Service: "client"})
+	assert.NoError(err)
+	assert.Equal(healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	// the gateway dials grpc with the server certificate
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	httpResp, err := client.Get("https://" + e.gateway.Addr + "/check?service=server")
+	assert.NoError(err)
+	body, _ := ioutil.ReadAll(httpResp.Body)
+	httpResp.Body.Close()
+	assert.JSONEq(`{"status":"SERVING"}`, string(body))
+
+	noCert := &tls.Config{RootCAs: tlsConfig.RootCAs, ServerName: "localhost"}
+	conn, err = grpc.Dial(e.listener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(noCert)))
+	assert.NoError(err)
+	defer conn.Close()
+	_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Equal(codes.Unavailable, status.Code(err))
+}
+
+// registeHealthWebHandler serves GET /check?service= through the health service.
+func registeHealthWebHandler(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error {
+	client := healthpb.NewHealthClient(conn)
+	pattern := runtime.MustPattern(runtime.NewPattern(1, []int{int(utilities.OpLitPush), 0}, []string{"check"}, ""))
+	mux.Handle(http.MethodGet, pattern, func(w http.ResponseWriter, req *http.Request, _ map[string]string) {
+		_, outbound := runtime.MarshalerForRequest(mux, req)
+		ctx, err := runtime.AnnotateContext(req.Context(), mux, req)
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, req, err)
+			return
+		}
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: req.URL.Query().Get("service")})
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, req, err)
+			return
+		}
+		runtime.ForwardResponseMessage(ctx, mux, outbound, w, req, resp, mux.GetForwardResponseOptions()...)
+	})
+	return nil
+}
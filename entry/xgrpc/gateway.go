@@ -0,0 +1,220 @@
+package xgrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"github.com/donech/tool/entry/gin/middleware"
+	"github.com/donech/tool/xlog"
+	"github.com/donech/tool/xtrace"
+)
+
+// runGateway dials the local grpc server and serves the handlers registered
+// through WithRegisteWebHandler on WebPort. It does nothing unless
+// EnableGateWay is set and a RegisteWebHandler is provided.
+func (e *Entry) runGateway() error {
+	if !e.config.EnableGateWay || e.registeWebHandler == nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.gatewayCancel = cancel
+	conn, err := grpc.DialContext(ctx, dialTarget(e.listener.Addr()), e.gatewayCredentials())
+	if err != nil {
+		return err
+	}
+	e.gatewayConn = conn
+
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(gatewayIncomingHeaderMatcher),
+		runtime.WithOutgoingHeaderMatcher(gatewayOutgoingHeaderMatcher),
+		runtime.WithProtoErrorHandler(gatewayErrorHandler),
+	)
+	if err := e.registeWebHandler(ctx, mux, conn); err != nil {
+		return err
+	}
+	listen, err := net.Listen("tcp", e.config.WebPort)
+	if err != nil {
+		return err
+	}
+	if e.tls != nil {
+		listen = tls.NewListener(listen, e.tls.ServerConfig())
+	}
+	srv := &http.Server{Addr: listen.Addr().String(), Handler: gatewayLog(time.RFC3339, true, mux)}
+	e.gateway = srv
+
+	go func() {
+		xlog.SS().Info("start grpc gateway at ", e.config.WebPort)
+		if err := srv.Serve(listen); err != nil && err != http.ErrServerClosed {
+			xlog.SS().Errorf("grpc gateway serve error: %s", err)
+			e.exit(err)
+		}
+	}()
+	return nil
+}
+
+// gatewayCredentials dials the local grpc server with the entry certificate,
+// verifying it against the name in that same certificate unless
+// Config.TLS.ServerName is set.
+func (e *Entry) gatewayCredentials() grpc.DialOption {
+	if e.tls == nil {
+		return grpc.WithInsecure()
+	}
+	serverName := ""
+	if cert := e.tls.Certificate(); cert != nil && cert.Leaf != nil {
+		serverName = cert.Leaf.Subject.CommonName
+		if len(cert.Leaf.DNSNames) > 0 {
+			serverName = cert.Leaf.DNSNames[0]
+		}
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(e.tls.ClientConfig(serverName)))
+}
+
+func (e *Entry) stopGateway(ctx context.Context) (err error) {
+	if e.gateway != nil {
+		err = e.gateway.Shutdown(ctx)
+	}
+	if e.gatewayCancel != nil {
+		e.gatewayCancel()
+	}
+	if e.gatewayConn != nil {
+		_ = e.gatewayConn.Close()
+	}
+	return err
+}
+
+// dialTarget turns a listen address such as [::]:9090 into one that can be dialed.
+func dialTarget(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// gatewayIncomingHeaderMatcher forwards the trace id as is, Authorization is
+// already forwarded by the gateway itself.
+func gatewayIncomingHeaderMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, string(xtrace.KeyName)) {
+		return strings.ToLower(key), true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// gatewayOutgoingHeaderMatcher drops the trace id sent back by TraceIdInterceptor,
+// gatewayLog has already set it on the response.
+func gatewayOutgoingHeaderMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, string(xtrace.KeyName)) {
+		return "", false
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+// gatewayErrorHandler writes grpc errors with the {code,msg,data} envelope.
+func gatewayErrorHandler(ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	s, ok := status.FromError(err)
+	if !ok {
+		s = status.New(codes.Unknown, err.Error())
+	}
+	w.Header().Del("Trailer")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(runtime.HTTPStatusFromCode(s.Code()))
+	body := map[string]interface{}{"code": int(s.Code()), "msg": s.Message(), "data": nil}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		xlog.S(r.Context()).Errorf("write gateway error response failed: %s", err)
+	}
+}
+
+// maxGatewayBodyLog bytes of a gateway response body are logged, the rest is
+// marked truncated so that large or streamed responses are not kept in memory.
+var maxGatewayBodyLog = 1024
+
+const truncatedMarker = "...(truncated)"
+
+type gatewayLogWriter struct {
+	http.ResponseWriter
+	status    int
+	body      *bytes.Buffer
+	truncated bool
+}
+
+func (w *gatewayLogWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *gatewayLogWriter) Write(b []byte) (int, error) {
+	if room := maxGatewayBodyLog - w.body.Len(); room >= len(b) {
+		w.body.Write(b)
+	} else {
+		if room > 0 {
+			w.body.Write(b[:room])
+		}
+		w.truncated = true
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// loggedBody returns the captured body with a marker when it was truncated.
+func (w *gatewayLogWriter) loggedBody() string {
+	if w.truncated {
+		return w.body.String() + truncatedMarker
+	}
+	return w.body.String()
+}
+
+func (w *gatewayLogWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// gatewayLog logs gateway requests through middleware.AccessLog, the fields
+// of GinZap, and makes sure every request carries a trace id forwarded to grpc.
+func gatewayLog(timeFormat string, utc bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header
+		traceID := xtrace.GetTraceIDFromHTTPHeader(header)
+		if traceID == "" {
+			traceID = xtrace.NewTraceID()
+			r.Header.Set(string(xtrace.KeyName), traceID)
+		}
+		ctx := context.WithValue(r.Context(), xtrace.KeyName, traceID)
+		r = r.WithContext(ctx)
+		w.Header().Set(string(xtrace.KeyName), traceID)
+		accessLog := middleware.NewAccessLog(r, traceID, clientIP(r), timeFormat, utc)
+		accessLog.Request(ctx, header)
+
+		lw := &gatewayLogWriter{ResponseWriter: w, status: http.StatusOK, body: bytes.NewBufferString("")}
+		next.ServeHTTP(lw, r)
+		accessLog.Response(ctx, lw.Header(), lw.status, lw.loggedBody())
+	})
+}
+
+func clientIP(r *http.Request) string {
+	if ip := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-For"), ",")[0]); ip != "" {
+		return ip
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-Ip")); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,77 @@
+package xgrpc
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/donech/tool/health"
+)
+
+var healthWatchInterval = 5 * time.Second
+
+// healthServer implements grpc.health.v1.Health on top of a health.Registry.
+// The empty service name reports overall readiness, any other name reports
+// the checker registered under it.
+type healthServer struct {
+	healthpb.UnimplementedHealthServer
+	registry *health.Registry
+}
+
+func newHealthServer(registry *health.Registry) *healthServer {
+	return &healthServer{registry: registry}
+}
+
+func (s *healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	st, found := s.status(ctx, req.GetService())
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "unknown service %s", req.GetService())
+	}
+	return &healthpb.HealthCheckResponse{Status: st}, nil
+}
+
+func (s *healthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	last := healthpb.HealthCheckResponse_ServingStatus(-1)
+	ticker := time.NewTicker(healthWatchInterval)
+	defer ticker.Stop()
+	for {
+		st, found := s.status(stream.Context(), req.GetService())
+		if !found {
+			st = healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+		}
+		if st != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: st}); err != nil {
+				return err
+			}
+			last = st
+		}
+		select {
+		case <-ticker.C:
+		case <-stream.Context().Done():
+			return status.Error(codes.Canceled, "stream has ended")
+		}
+	}
+}
+
+func (s *healthServer) status(ctx context.Context, service string) (healthpb.HealthCheckResponse_ServingStatus, bool) {
+	if s.registry.IsShutdown() {
+		return healthpb.HealthCheckResponse_NOT_SERVING, true
+	}
+	if service == "" {
+		if s.registry.Ready(ctx).Up() {
+			return healthpb.HealthCheckResponse_SERVING, true
+		}
+		return healthpb.HealthCheckResponse_NOT_SERVING, true
+	}
+	found, err := s.registry.CheckOne(ctx, service)
+	if !found {
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN, false
+	}
+	if err != nil {
+		return healthpb.HealthCheckResponse_NOT_SERVING, true
+	}
+	return healthpb.HealthCheckResponse_SERVING, true
+}
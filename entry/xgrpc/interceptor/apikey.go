@@ -0,0 +1,93 @@
+package interceptor
+
+import (
+	"context"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/util/metautils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/donech/tool/apikey"
+	"github.com/donech/tool/xlog"
+)
+
+// NewManagerAuthenticator authenticates the x-api-key header through m, to be
+// combined with jwt through WithAuthenticators.
+func NewManagerAuthenticator(m *apikey.Manager) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context) (context.Context, error) {
+		plaintext := metautils.ExtractIncoming(ctx).Get(headerAPIKey)
+		if plaintext == "" {
+			return nil, ErrNoCredentials
+		}
+		key, err := m.Authenticate(ctx, plaintext)
+		if err != nil {
+			xlog.S(ctx).Errorf("authenticate api key error, %+v", err)
+			if err == apikey.ErrExpired {
+				return nil, unauthenticated("api_key_expired")
+			}
+			return nil, unauthenticated("invalid_api_key")
+		}
+		return apikey.NewContext(ctx, key), nil
+	})
+}
+
+// APIKeyInterceptor authenticates every call except Jumps with the api key of
+// the x-api-key header. Scopes maps a full method, or a /pkg.Service/* pattern,
+// to the scopes the key must grant.
+type APIKeyInterceptor struct {
+	Manager *apikey.Manager
+	Jumps   map[string]bool
+	Scopes  map[string][]string
+}
+
+func (i *APIKeyInterceptor) Serve(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	if matchMethod(i.Jumps, info.FullMethod) {
+		return handler(ctx, req)
+	}
+	newCtx, err := i.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(newCtx, req)
+}
+
+func (i *APIKeyInterceptor) StreamServe(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if matchMethod(i.Jumps, info.FullMethod) {
+		return handler(srv, stream)
+	}
+	newCtx, err := i.authenticate(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, WrapServerStream(stream).WithContext(newCtx))
+}
+
+func (i *APIKeyInterceptor) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	newCtx, err := NewManagerAuthenticator(i.Manager).Authenticate(ctx)
+	if err == ErrNoCredentials {
+		return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, _ := apikey.FromContext(newCtx)
+	for _, scope := range methodScopes(i.Scopes, fullMethod) {
+		if !key.HasScope(scope) {
+			return nil, status.Error(codes.PermissionDenied, "api key lacks scope "+scope)
+		}
+	}
+	return newCtx, nil
+}
+
+func methodScopes(scopes map[string][]string, fullMethod string) []string {
+	if s, ok := scopes[fullMethod]; ok {
+		return s
+	}
+	for pattern, s := range scopes {
+		if matchPattern(pattern, fullMethod) {
+			return s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/donech/tool/apikey"
+	"github.com/donech/tool/xjwt"
+)
+
+func TestAPIKeyInterceptor_Serve(t *testing.T) {
+	assert := require.New(t)
+	m := apikey.NewManager(apikey.NewMemoryStore())
+	plaintext, _, err := m.Issue(context.Background(), apikey.IssueRequest{Subject: "svc", Scopes: []string{"order:read"}})
+	assert.NoError(err)
+	i := APIKeyInterceptor{
+		Manager: m,
+		Jumps:   map[string]bool{"/shop.Public/*": true},
+		Scopes:  map[string][]string{"/shop.Order/Get": {"order:read"}, "/shop.Order/*": {"order:write"}},
+	}
+	serve := func(method, key string) (string, error) {
+		var sub string
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(headerAPIKey, key))
+		_, err := i.Serve(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			sub, _ = xjwt.GetClaimsFromCtx(ctx)["sub"].(string)
+			return nil, nil
+		})
+		return sub, err
+	}
+
+	sub, err := serve("/shop.Order/Get", plaintext)
+	assert.NoError(err)
+	assert.Equal("svc", sub)
+	_, err = serve("/shop.Order/Cancel", plaintext)
+	assert.Equal(codes.PermissionDenied, status.Code(err))
+	_, err = serve("/shop.Order/Get", "ak_0000_0000")
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+	_, err = serve("/shop.Order/Get", "")
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+	_, err = serve("/shop.Public/Ping", "")
+	assert.NoError(err)
+}
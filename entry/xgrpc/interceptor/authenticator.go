@@ -0,0 +1,109 @@
+package interceptor
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/grpc-ecosystem/go-grpc-middleware/util/metautils"
+
+	"github.com/donech/tool/xjwt"
+	"github.com/donech/tool/xlog"
+	"github.com/donech/tool/xtls"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the call carries none
+// of its credentials, the next Authenticator is tried then.
+var ErrNoCredentials = errors.New("no credentials")
+
+var headerAPIKey = "x-api-key"
+
+// Authenticator authenticates a call from its context and returns the context
+// carrying the claims, see xjwt.GetClaimsFromCtx. Errors other than
+// ErrNoCredentials fail the call, grpc status errors are returned as is.
+type Authenticator interface {
+	Authenticate(ctx context.Context) (context.Context, error)
+}
+
+type AuthenticatorFunc func(ctx context.Context) (context.Context, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context) (context.Context, error) {
+	return f(ctx)
+}
+
+// NewJWTAuthenticator verifies the token of the authorization header, a
+// "Bearer " prefix is stripped.
+func NewJWTAuthenticator(factory *xjwt.JWTFactory) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context) (context.Context, error) {
+		token := bearerToken(metautils.ExtractIncoming(ctx).Get(headerAuthorize))
+		if token == "" {
+			return nil, ErrNoCredentials
+		}
+		claims, err := factory.GetClaimsContext(ctx, token)
+		if err != nil {
+			xlog.S(ctx).Errorf("jwt GetClaims error, %+v", err)
+			return nil, unauthenticated(xjwt.ErrorReason(err))
+		}
+		newCtx, err := factory.NewContext(ctx, claims)
+		if err != nil {
+			xlog.S(ctx).Errorf("jwt decode claims error, %+v", err)
+			return nil, unauthenticated(xjwt.ErrorReason(err))
+		}
+		return newCtx, nil
+	})
+}
+
+const bearerPrefix = "bearer "
+
+func bearerToken(token string) string {
+	token = strings.TrimSpace(token)
+	if len(token) > len(bearerPrefix) && strings.EqualFold(token[:len(bearerPrefix)], bearerPrefix) {
+		token = strings.TrimSpace(token[len(bearerPrefix):])
+	}
+	return token
+}
+
+// APIKeyLookup returns the claims of an api key, or an error when the key is unknown.
+type APIKeyLookup func(ctx context.Context, key string) (jwt.MapClaims, error)
+
+// NewAPIKeyAuthenticator authenticates the api key of the x-api-key header through lookup.
+func NewAPIKeyAuthenticator(lookup APIKeyLookup) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context) (context.Context, error) {
+		key := metautils.ExtractIncoming(ctx).Get(headerAPIKey)
+		if key == "" {
+			return nil, ErrNoCredentials
+		}
+		claims, err := lookup(ctx, key)
+		if err != nil {
+			xlog.S(ctx).Errorf("api key lookup error, %+v", err)
+			return nil, unauthenticated("invalid_api_key")
+		}
+		return xjwt.SetClaimsToCtx(ctx, claims), nil
+	})
+}
+
+// IdentityClaims maps a client certificate to claims.
+type IdentityClaims func(identity xtls.Identity) (jwt.MapClaims, error)
+
+// NewIdentityAuthenticator authenticates the verified client certificate of a
+// mutual TLS connection, a nil claims sets the common name as sub.
+func NewIdentityAuthenticator(claims IdentityClaims) Authenticator {
+	if claims == nil {
+		claims = func(identity xtls.Identity) (jwt.MapClaims, error) {
+			return jwt.MapClaims{"sub": identity.CommonName}, nil
+		}
+	}
+	return AuthenticatorFunc(func(ctx context.Context) (context.Context, error) {
+		identity, ok := xtls.GetIdentityFromCtx(identityCtx(ctx))
+		if !ok {
+			return nil, ErrNoCredentials
+		}
+		c, err := claims(identity)
+		if err != nil {
+			xlog.S(ctx).Errorf("client certificate %s rejected, %+v", identity.CommonName, err)
+			return nil, unauthenticated("invalid_certificate")
+		}
+		return xjwt.SetClaimsToCtx(ctx, c), nil
+	})
+}
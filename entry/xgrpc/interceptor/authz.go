@@ -0,0 +1,46 @@
+package interceptor
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/donech/tool/authz"
+	"github.com/donech/tool/xlog"
+)
+
+// AuthzInterceptor checks the permissions the policy table of RBAC requires
+// for each full method. It must be chained after JwtInterceptor, methods
+// missing from the table are let through.
+type AuthzInterceptor struct {
+	RBAC *authz.RBAC
+}
+
+func (i *AuthzInterceptor) Serve(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	if err := i.authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (i *AuthzInterceptor) StreamServe(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := i.authorize(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+func (i *AuthzInterceptor) authorize(ctx context.Context, fullMethod string) error {
+	err := i.RBAC.AuthorizeMethod(ctx, fullMethod)
+	if err == nil {
+		return nil
+	}
+	xlog.S(ctx).Warnf("authorize %s failed: %s", fullMethod, err)
+	if errors.Is(err, authz.ErrUnauthenticated) {
+		return status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+	return status.Error(codes.PermissionDenied, err.Error())
+}
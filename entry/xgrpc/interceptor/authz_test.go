@@ -0,0 +1,43 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/donech/tool/authz"
+	"github.com/donech/tool/xjwt"
+)
+
+func TestAuthzInterceptor_Serve(t *testing.T) {
+	assert := require.New(t)
+	rbac, err := authz.New(authz.Policy{
+		Roles:   map[string][]string{"viewer": {"order:read"}},
+		Methods: map[string][]string{"/shop.Order/Get": {"order:read"}, "/shop.Order/*": {"order:write"}},
+	})
+	assert.NoError(err)
+	i := AuthzInterceptor{RBAC: rbac}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	serve := func(ctx context.Context, method string) error {
+		_, err := i.Serve(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	assert.Equal(codes.Unauthenticated, status.Code(serve(context.Background(), "/shop.Order/Get")))
+	assert.NoError(serve(context.Background(), "/shop.User/Get"))
+	ctx := xjwt.SetClaimsToCtx(context.Background(), jwt.MapClaims{"roles": []interface{}{"viewer"}})
+	assert.NoError(serve(ctx, "/shop.Order/Get"))
+	assert.Equal(codes.PermissionDenied, status.Code(serve(ctx, "/shop.Order/Cancel")))
+
+	err = i.StreamServe(nil, &fakeServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/shop.Order/Watch"}, func(srv interface{}, s grpc.ServerStream) error {
+		return nil
+	})
+	assert.Equal(codes.PermissionDenied, status.Code(err))
+}
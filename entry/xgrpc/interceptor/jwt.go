@@ -2,14 +2,19 @@ package interceptor
 
 import (
 	"context"
+	"path"
+	"strings"
+	"sync"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 
 	"github.com/donech/tool/xlog"
 
-	"github.com/grpc-ecosystem/go-grpc-middleware/util/metautils"
-
 	"github.com/donech/tool/xjwt"
 
 	"google.golang.org/grpc"
@@ -19,33 +24,152 @@ var (
 	headerAuthorize = "authorization"
 )
 
+// JwtInterceptor authenticates every call except the public methods. Public
+// methods are the keys of jumps, which may be glob patterns like
+// /pkg.Service/*, and the methods marked with the bool method option set by
+// WithPublicOption. Calls are authenticated with the jwt factory first, then
+// with the authenticators set by WithAuthenticators.
 type JwtInterceptor struct {
-	jwtFactory  *xjwt.JWTFactory
-	jumpMethods map[string]bool
+	jwtFactory     *xjwt.JWTFactory
+	jumpMethods    map[string]bool
+	publicOption   protoreflect.ExtensionType
+	authenticators []Authenticator
+	optionCache    sync.Map
+}
+
+type JwtOption func(i *JwtInterceptor)
+
+// WithPublicOption makes the methods whose options set ext to true public, ext
+// is a bool extension of google.protobuf.MethodOptions such as
+//
+//	extend google.protobuf.MethodOptions { bool public = 50001; }
+//	rpc Login(LoginRequest) returns (LoginReply) { option (public) = true; }
+func WithPublicOption(ext protoreflect.ExtensionType) JwtOption {
+	return func(i *JwtInterceptor) {
+		i.publicOption = ext
+	}
 }
 
-func NewJwtInterceptor(jwtFactory *xjwt.JWTFactory, jumps map[string]bool) *JwtInterceptor {
-	return &JwtInterceptor{jwtFactory: jwtFactory, jumpMethods: jumps}
+// WithAuthenticators authenticates calls without a jwt token, e.g. by api key
+// or client certificate.
+func WithAuthenticators(authenticators ...Authenticator) JwtOption {
+	return func(i *JwtInterceptor) {
+		i.authenticators = append(i.authenticators, authenticators...)
+	}
+}
+
+func NewJwtInterceptor(jwtFactory *xjwt.JWTFactory, jumps map[string]bool, opts ...JwtOption) *JwtInterceptor {
+	i := &JwtInterceptor{jwtFactory: jwtFactory, jumpMethods: jumps}
+	for _, o := range opts {
+		o(i)
+	}
+	if jwtFactory != nil {
+		i.authenticators = append([]Authenticator{NewJWTAuthenticator(jwtFactory)}, i.authenticators...)
+	}
+	return i
 }
 
 func (i *JwtInterceptor) Serve(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
-	if i.jumpMethods == nil {
+	if i.jump(info.FullMethod) {
 		return handler(ctx, req)
 	}
-	if i.jumpMethods[info.FullMethod] {
-		return handler(ctx, req)
+	newCtx, err := i.authenticate(ctx)
+	if err != nil {
+		return nil, err
 	}
-	token := metautils.ExtractIncoming(ctx).Get(headerAuthorize)
-	if token == "" {
-		xlog.S(ctx).Error("no token found")
-		return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+	return handler(newCtx, req)
+}
+
+func (i *JwtInterceptor) StreamServe(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if i.jump(info.FullMethod) {
+		return handler(srv, stream)
 	}
-	claims, err := i.jwtFactory.GetClaims(token)
+	newCtx, err := i.authenticate(stream.Context())
 	if err != nil {
-		xlog.S(ctx).Error("jwt GetClaims error, %+v", err)
-		return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+		return err
 	}
-	newCtx := xjwt.SetClaimsToCtx(ctx, claims)
-	return handler(newCtx, req)
+	return handler(srv, WrapServerStream(stream).WithContext(newCtx))
+}
+
+// jump reports whether fullMethod is public, no method is public by default.
+func (i *JwtInterceptor) jump(fullMethod string) bool {
+	return matchMethod(i.jumpMethods, fullMethod) || i.publicByOption(fullMethod)
+}
+
+// matchMethod looks fullMethod up in methods, whose keys may be glob patterns.
+func matchMethod(methods map[string]bool, fullMethod string) bool {
+	if match, ok := methods[fullMethod]; ok {
+		return match
+	}
+	for pattern, match := range methods {
+		if match && matchPattern(pattern, fullMethod) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPattern(pattern, fullMethod string) bool {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return false
+	}
+	ok, _ := path.Match(pattern, fullMethod)
+	return ok
+}
+
+func (i *JwtInterceptor) publicByOption(fullMethod string) bool {
+	if i.publicOption == nil {
+		return false
+	}
+	if public, ok := i.optionCache.Load(fullMethod); ok {
+		return public.(bool)
+	}
+	public := methodOption(fullMethod, i.publicOption)
+	i.optionCache.Store(fullMethod, public)
+	return public
+}
 
+// methodOption reads the bool option ext of the method registered in protoregistry.GlobalFiles.
+func methodOption(fullMethod string, ext protoreflect.ExtensionType) bool {
+	name := strings.Replace(strings.TrimPrefix(fullMethod, "/"), "/", ".", 1)
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return false
+	}
+	method, ok := d.(protoreflect.MethodDescriptor)
+	if !ok || method.Options() == nil || !proto.HasExtension(method.Options(), ext) {
+		return false
+	}
+	public, ok := proto.GetExtension(method.Options(), ext).(bool)
+	return ok && public
+}
+
+func (i *JwtInterceptor) authenticate(ctx context.Context) (context.Context, error) {
+	for _, a := range i.authenticators {
+		newCtx, err := a.Authenticate(ctx)
+		if err == ErrNoCredentials {
+			continue
+		}
+		if err != nil {
+			if _, ok := status.FromError(err); !ok {
+				xlog.S(ctx).Errorf("authenticate error, %+v", err)
+				return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+			}
+			return nil, err
+		}
+		return newCtx, nil
+	}
+	xlog.S(ctx).Error("no token found")
+	return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+}
+
+// unauthenticated carries reason as an ErrorInfo detail so that clients can
+// tell an expired token from a forged one.
+func unauthenticated(reason string) error {
+	st, err := status.New(codes.Unauthenticated, "Unauthorized").
+		WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: "xjwt"})
+	if err != nil {
+		return status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+	return st.Err()
 }
@@ -0,0 +1,161 @@
+package interceptor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/donech/tool/xjwt"
+)
+
+func TestJwtInterceptor_Serve_Reason(t *testing.T) {
+	assert := require.New(t)
+	expired, err := xjwt.NewJWTFactory(xjwt.Config{SingingAlgorithm: "HS256", Key: "stream-test", Timeout: "-1m"},
+		xjwt.WithLoginFunc(func(ctx context.Context, form xjwt.LoginForm) (jwt.MapClaims, error) {
+			return jwt.MapClaims{}, nil
+		}))
+	assert.NoError(err)
+	token, err := expired.GenerateTokenWithClaims(jwt.MapClaims{"id": 1})
+	assert.NoError(err)
+
+	i := NewJwtInterceptor(newJWTFactory(t), map[string]bool{})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{headerAuthorize: token}))
+	_, err = i.Serve(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Get"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	st := status.Convert(err)
+	assert.Equal(codes.Unauthenticated, st.Code())
+	assert.Len(st.Details(), 1)
+	assert.Equal("token_expired", st.Details()[0].(*errdetails.ErrorInfo).Reason)
+}
+
+func TestJwtInterceptor_SecureByDefault(t *testing.T) {
+	assert := require.New(t)
+	factory := newJWTFactory(t)
+	token, err := factory.GenerateToken(context.Background(), xjwt.LoginForm{Username: "unary", Password: "pass"})
+	assert.NoError(err)
+	serve := func(i *JwtInterceptor, method string, md metadata.MD) (context.Context, error) {
+		var got context.Context
+		_, err := i.Serve(metadata.NewIncomingContext(context.Background(), md), nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				got = ctx
+				return nil, nil
+			})
+		return got, err
+	}
+
+	_, err = serve(NewJwtInterceptor(factory, nil), "/pkg.Service/Get", nil)
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+
+	i := NewJwtInterceptor(factory, map[string]bool{"/pkg.Public/*": true, "/pkg.Service/Hidden": false})
+	_, err = serve(i, "/pkg.Public/Get", nil)
+	assert.NoError(err)
+	_, err = serve(i, "/pkg.Service/Hidden", nil)
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+	ctx, err := serve(i, "/pkg.Service/Get", metadata.Pairs(headerAuthorize, "Bearer "+token))
+	assert.NoError(err)
+	assert.Equal("unary", xjwt.GetClaimsFromCtx(ctx)["username"])
+}
+
+func TestJwtInterceptor_Authenticators(t *testing.T) {
+	assert := require.New(t)
+	apiKey := NewAPIKeyAuthenticator(func(ctx context.Context, key string) (jwt.MapClaims, error) {
+		if key != "secret" {
+			return nil, errors.New("unknown key")
+		}
+		return jwt.MapClaims{"sub": "service-a"}, nil
+	})
+	i := NewJwtInterceptor(nil, nil, WithAuthenticators(apiKey, NewIdentityAuthenticator(nil)))
+	serve := func(ctx context.Context) (string, error) {
+		var sub string
+		_, err := i.Serve(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Get"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			sub, _ = xjwt.GetClaimsFromCtx(ctx)["sub"].(string)
+			return nil, nil
+		})
+		return sub, err
+	}
+
+	sub, err := serve(metadata.NewIncomingContext(context.Background(), metadata.Pairs(headerAPIKey, "secret")))
+	assert.NoError(err)
+	assert.Equal("service-a", sub)
+	_, err = serve(metadata.NewIncomingContext(context.Background(), metadata.Pairs(headerAPIKey, "wrong")))
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "service-b"}}
+	state := tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+	sub, err = serve(ctx)
+	assert.NoError(err)
+	assert.Equal("service-b", sub)
+
+	_, err = serve(context.Background())
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+}
+
+func TestJwtInterceptor_PublicOption(t *testing.T) {
+	assert := require.New(t)
+	optionFile := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("xgrpc/interceptor/public_option_test.proto"),
+		Package:    proto.String("interceptortest"),
+		Dependency: []string{"google/protobuf/descriptor.proto"},
+		Extension: []*descriptorpb.FieldDescriptorProto{{
+			Name:     proto.String("public"),
+			Number:   proto.Int32(50001),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_TYPE_BOOL.Enum(),
+			Extendee: proto.String(".google.protobuf.MethodOptions"),
+		}},
+	}
+	fd, err := protodesc.NewFile(optionFile, protoregistry.GlobalFiles)
+	assert.NoError(err)
+	public := dynamicpb.NewExtensionType(fd.Extensions().Get(0))
+
+	options := &descriptorpb.MethodOptions{}
+	proto.SetExtension(options, public, true)
+	empty := "google.protobuf.Empty"
+	serviceFile := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("xgrpc/interceptor/public_service_test.proto"),
+		Package:    proto.String("interceptortest"),
+		Dependency: []string{"google/protobuf/empty.proto"},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Greeter"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("Hello"), InputType: proto.String("." + empty), OutputType: proto.String("." + empty), Options: options},
+				{Name: proto.String("Secret"), InputType: proto.String("." + empty), OutputType: proto.String("." + empty)},
+			},
+		}},
+	}
+	registry := new(protoregistry.Files)
+	assert.NoError(registry.RegisterFile(emptypb.File_google_protobuf_empty_proto))
+	sd, err := protodesc.NewFile(serviceFile, registry)
+	assert.NoError(err)
+	assert.NoError(protoregistry.GlobalFiles.RegisterFile(sd))
+
+	i := NewJwtInterceptor(newJWTFactory(t), nil, WithPublicOption(public))
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	_, err = i.Serve(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/interceptortest.Greeter/Hello"}, handler)
+	assert.NoError(err)
+	_, err = i.Serve(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/interceptortest.Greeter/Secret"}, handler)
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+}
@@ -2,6 +2,7 @@ package interceptor
 
 import (
 	"context"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -18,3 +19,23 @@ func (i *LogInterceptor) Serve(ctx context.Context, req interface{}, info *grpc.
 	xlog.L(ctx).Info("output grpc resp", zap.Reflect("resp", resp), zap.Error(err))
 	return resp, err
 }
+
+func (i *LogInterceptor) StreamServe(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	wrapped := WrapServerStream(stream)
+	ctx := wrapped.Context()
+	xlog.L(ctx).Info("incoming grpc stream",
+		zap.String("method", info.FullMethod),
+		zap.Bool("client_stream", info.IsClientStream),
+		zap.Bool("server_stream", info.IsServerStream),
+	)
+	err := handler(srv, wrapped)
+	xlog.L(ctx).Info("output grpc stream",
+		zap.String("method", info.FullMethod),
+		zap.Int64("received", wrapped.Received()),
+		zap.Int64("sent", wrapped.Sent()),
+		zap.Duration("latency", time.Since(start)),
+		zap.Error(err),
+	)
+	return err
+}
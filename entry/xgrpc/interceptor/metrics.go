@@ -0,0 +1,47 @@
+package interceptor
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/donech/tool/metrics"
+)
+
+// MetricsInterceptor records call count, latency and in-flight calls by full
+// method and code. It must be chained after RecoveryInterceptor so that it
+// sees panics first, counts them and passes them on.
+type MetricsInterceptor struct {
+	Metrics *metrics.Metrics
+}
+
+func (i *MetricsInterceptor) Serve(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer i.observe(info.FullMethod, time.Now(), &err)()
+	return handler(ctx, req)
+}
+
+func (i *MetricsInterceptor) StreamServe(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer i.observe(info.FullMethod, time.Now(), &err)()
+	return handler(srv, stream)
+}
+
+func (i *MetricsInterceptor) observe(method string, start time.Time, err *error) func() {
+	i.Metrics.GRPCInFlight.Inc()
+	return func() {
+		i.Metrics.GRPCInFlight.Dec()
+		code := status.Code(*err)
+		r := recover()
+		if r != nil {
+			i.Metrics.Panics.WithLabelValues(metrics.EntryGRPC).Inc()
+			code = codes.Internal
+		}
+		i.Metrics.GRPCRequests.WithLabelValues(method, code.String()).Inc()
+		i.Metrics.GRPCDuration.WithLabelValues(method, code.String()).Observe(time.Since(start).Seconds())
+		if r != nil {
+			panic(r)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/donech/tool/metrics"
+)
+
+func TestMetricsInterceptor(t *testing.T) {
+	assert := require.New(t)
+	m := metrics.New("test")
+	recovery := RecoveryInterceptor{}
+	i := MetricsInterceptor{Metrics: m}
+	info := &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Get"}
+
+	_, err := i.Serve(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+	assert.Equal(codes.NotFound, status.Code(err))
+
+	_, err = recovery.Serve(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return i.Serve(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			panic("boom")
+		})
+	})
+	assert.Equal(codes.Internal, status.Code(err))
+
+	stream := &fakeServerStream{ctx: context.Background()}
+	err = i.StreamServe(nil, stream, &grpc.StreamServerInfo{FullMethod: "/pkg.Service/Watch"}, func(srv interface{}, s grpc.ServerStream) error {
+		return nil
+	})
+	assert.NoError(err)
+
+	assert.Equal(float64(1), testutil.ToFloat64(m.GRPCRequests.WithLabelValues("/pkg.Service/Get", "NotFound")))
+	assert.Equal(float64(1), testutil.ToFloat64(m.GRPCRequests.WithLabelValues("/pkg.Service/Get", "Internal")))
+	assert.Equal(float64(1), testutil.ToFloat64(m.GRPCRequests.WithLabelValues("/pkg.Service/Watch", "OK")))
+	assert.Equal(float64(1), testutil.ToFloat64(m.Panics.WithLabelValues(metrics.EntryGRPC)))
+	assert.Equal(float64(0), testutil.ToFloat64(m.GRPCInFlight))
+}
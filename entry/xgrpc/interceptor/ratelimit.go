@@ -0,0 +1,104 @@
+package interceptor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/donech/tool/ratelimit"
+	"github.com/donech/tool/xjwt"
+	"github.com/donech/tool/xlog"
+)
+
+var headerRetryAfter = "retry-after"
+
+// RateLimitKeyFunc returns the key a call is limited by.
+type RateLimitKeyFunc func(ctx context.Context, fullMethod string) string
+
+// RateLimitByMethod limits by full method, all clients share the quota.
+func RateLimitByMethod(ctx context.Context, fullMethod string) string {
+	return "method:" + fullMethod
+}
+
+// RateLimitByPeer limits by client ip.
+func RateLimitByPeer(ctx context.Context, fullMethod string) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "ip:unknown"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return "ip:" + p.Addr.String()
+	}
+	return "ip:" + host
+}
+
+// RateLimitByClaim limits by a jwt claim set by JwtInterceptor, such as id,
+// and falls back to the client ip for anonymous calls. It must be chained
+// after JwtInterceptor.
+func RateLimitByClaim(name string) RateLimitKeyFunc {
+	return func(ctx context.Context, fullMethod string) string {
+		if v, ok := xjwt.GetClaimsFromCtx(ctx)[name]; ok {
+			return "claim:" + name + ":" + fmt.Sprint(v)
+		}
+		return RateLimitByPeer(ctx, fullMethod)
+	}
+}
+
+// RateLimitInterceptor rejects calls over the limit with codes.ResourceExhausted,
+// a retry-after trailer in seconds and a RetryInfo detail. Calls are let
+// through when the limiter itself fails, e.g. redis is down.
+type RateLimitInterceptor struct {
+	Limiter ratelimit.Limiter
+	Key     RateLimitKeyFunc // nil keys by RateLimitByPeer
+}
+
+func (i *RateLimitInterceptor) Serve(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	if md, err := i.limit(ctx, info.FullMethod); err != nil {
+		if terr := grpc.SetTrailer(ctx, md); terr != nil {
+			xlog.S(ctx).Errorf("grpc set retry-after trailer error: %s", terr)
+		}
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (i *RateLimitInterceptor) StreamServe(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if md, err := i.limit(stream.Context(), info.FullMethod); err != nil {
+		stream.SetTrailer(md)
+		return err
+	}
+	return handler(srv, stream)
+}
+
+func (i *RateLimitInterceptor) limit(ctx context.Context, fullMethod string) (metadata.MD, error) {
+	key := i.Key
+	if key == nil {
+		key = RateLimitByPeer
+	}
+	res, err := i.Limiter.Allow(ctx, key(ctx, fullMethod))
+	if err != nil {
+		xlog.S(ctx).Errorf("rate limit error: %s", err)
+		return nil, nil
+	}
+	if res.Allowed {
+		return nil, nil
+	}
+	seconds := int(math.Ceil(res.RetryAfter.Seconds()))
+	st, err := status.New(codes.ResourceExhausted, "rate limit exceeded, retry after "+strconv.Itoa(seconds)+"s").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(res.RetryAfter)})
+	if err != nil {
+		st = status.New(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	return metadata.Pairs(headerRetryAfter, strconv.Itoa(seconds)), st.Err()
+}
@@ -0,0 +1,76 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/donech/tool/ratelimit"
+)
+
+func TestRateLimitInterceptor_StreamServe(t *testing.T) {
+	assert := require.New(t)
+	i := RateLimitInterceptor{Limiter: ratelimit.NewTokenBucket(1, time.Minute, 1), Key: RateLimitByMethod}
+	info := &grpc.StreamServerInfo{FullMethod: "/pkg.Service/Watch"}
+	handler := func(srv interface{}, s grpc.ServerStream) error {
+		return nil
+	}
+
+	assert.NoError(i.StreamServe(nil, &fakeServerStream{ctx: context.Background()}, info, handler))
+	stream := &fakeServerStream{ctx: context.Background()}
+	err := i.StreamServe(nil, stream, info, handler)
+	assert.Equal([]string{"60"}, stream.trailer.Get(headerRetryAfter))
+	st := status.Convert(err)
+	assert.Equal(codes.ResourceExhausted, st.Code())
+	assert.Len(st.Details(), 1)
+	assert.IsType(&errdetails.RetryInfo{}, st.Details()[0])
+
+	_, err = i.Serve(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Get"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+	assert.NoError(err)
+}
+
+func TestRateLimitInterceptor_RetryAfter(t *testing.T) {
+	assert := require.New(t)
+	trace := TraceIdInterceptor{}
+	i := RateLimitInterceptor{Limiter: ratelimit.NewTokenBucket(1, time.Minute, 1), Key: RateLimitByMethod}
+	get := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &emptypb.Empty{}, nil
+	}
+	watch := func(srv interface{}, stream grpc.ServerStream) error {
+		return stream.SendMsg(&emptypb.Empty{})
+	}
+	conn := startTestServer(t, testServiceDesc(get, watch),
+		grpc.ChainUnaryInterceptor(trace.Serve, i.Serve),
+		grpc.ChainStreamInterceptor(trace.StreamServe, i.StreamServe))
+	ctx := context.Background()
+
+	assert.NoError(conn.Invoke(ctx, "/test.Service/Get", &emptypb.Empty{}, &emptypb.Empty{}))
+	var trailer metadata.MD
+	err := conn.Invoke(ctx, "/test.Service/Get", &emptypb.Empty{}, &emptypb.Empty{}, grpc.Trailer(&trailer))
+	assert.Equal(codes.ResourceExhausted, status.Code(err))
+	assert.Equal([]string{"60"}, trailer.Get(headerRetryAfter))
+
+	desc := &grpc.StreamDesc{ServerStreams: true}
+	for n := 0; n < 2; n++ {
+		stream, err := conn.NewStream(ctx, desc, "/test.Service/Watch")
+		assert.NoError(err)
+		assert.NoError(stream.CloseSend())
+		err = stream.RecvMsg(&emptypb.Empty{})
+		if n == 0 {
+			assert.NoError(err)
+			continue
+		}
+		assert.Equal(codes.ResourceExhausted, status.Code(err))
+		assert.Equal([]string{"60"}, stream.Trailer().Get(headerRetryAfter))
+	}
+}
@@ -0,0 +1,43 @@
+package interceptor
+
+import (
+	"context"
+	"runtime/debug"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/donech/tool/xlog"
+)
+
+// RecoveryInterceptor turns a panic in a handler into a codes.Internal error.
+type RecoveryInterceptor struct{}
+
+func (i *RecoveryInterceptor) Serve(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoverError(ctx, info.FullMethod, r)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func (i *RecoveryInterceptor) StreamServe(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoverError(stream.Context(), info.FullMethod, r)
+		}
+	}()
+	return handler(srv, stream)
+}
+
+func recoverError(ctx context.Context, method string, r interface{}) error {
+	xlog.L(ctx).Error("[Recovery from panic]",
+		zap.String("method", method),
+		zap.Any("error", r),
+		zap.String("stack", string(debug.Stack())),
+	)
+	return status.Error(codes.Internal, "Internal Server Error")
+}
@@ -0,0 +1,48 @@
+package interceptor
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// testServiceDesc is a service without generated code, Get is unary and
+// Watch streams from the server.
+func testServiceDesc(get grpc.UnaryHandler, watch grpc.StreamHandler) *grpc.ServiceDesc {
+	return &grpc.ServiceDesc{
+		ServiceName: "test.Service",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Get",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := &emptypb.Empty{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return get(ctx, in)
+				}
+				return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/test.Service/Get"}, get)
+			},
+		}},
+		Streams: []grpc.StreamDesc{{StreamName: "Watch", Handler: watch, ServerStreams: true}},
+	}
+}
+
+// startTestServer serves desc with opts and returns a connection to it.
+func startTestServer(t *testing.T, desc *grpc.ServiceDesc, opts ...grpc.ServerOption) *grpc.ClientConn {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer(opts...)
+	srv.RegisterService(desc, struct{}{})
+	go srv.Serve(l)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
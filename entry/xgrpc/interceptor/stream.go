@@ -0,0 +1,68 @@
+package interceptor
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	"github.com/donech/tool/xlog"
+)
+
+// ServerStream wraps a grpc.ServerStream so that stream interceptors can
+// pass an enriched context down the chain, it also counts and logs the
+// messages received and sent.
+type ServerStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	received int64
+	sent     int64
+}
+
+// WrapServerStream returns stream itself if it is already wrapped, so that the
+// whole chain shares the same counters.
+func WrapServerStream(stream grpc.ServerStream) *ServerStream {
+	if s, ok := stream.(*ServerStream); ok {
+		return s
+	}
+	return &ServerStream{ServerStream: stream, ctx: stream.Context()}
+}
+
+func (s *ServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// WithContext replaces the context returned by Context.
+func (s *ServerStream) WithContext(ctx context.Context) *ServerStream {
+	s.ctx = ctx
+	return s
+}
+
+func (s *ServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		n := atomic.AddInt64(&s.received, 1)
+		xlog.L(s.ctx).Debug("grpc stream recv msg", zap.Int64("count", n))
+	}
+	return err
+}
+
+func (s *ServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		n := atomic.AddInt64(&s.sent, 1)
+		xlog.L(s.ctx).Debug("grpc stream send msg", zap.Int64("count", n))
+	}
+	return err
+}
+
+// Received returns the number of messages received so far.
+func (s *ServerStream) Received() int64 {
+	return atomic.LoadInt64(&s.received)
+}
+
+// Sent returns the number of messages sent so far.
+func (s *ServerStream) Sent() int64 {
+	return atomic.LoadInt64(&s.sent)
+}
@@ -0,0 +1,147 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/donech/tool/xjwt"
+	"github.com/donech/tool/xtrace"
+)
+
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeServerStream) SendHeader(md metadata.MD) error {
+	s.header = md
+	return nil
+}
+
+func (s *fakeServerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *fakeServerStream) SetTrailer(md metadata.MD) {
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+func (s *fakeServerStream) SendMsg(m interface{}) error {
+	return nil
+}
+
+func (s *fakeServerStream) RecvMsg(m interface{}) error {
+	return nil
+}
+
+func newJWTFactory(t *testing.T) *xjwt.JWTFactory {
+	f, err := xjwt.NewJWTFactory(xjwt.Config{SingingAlgorithm: "HS256", Key: "stream-test", Timeout: "10m"},
+		xjwt.WithLoginFunc(func(ctx context.Context, form xjwt.LoginForm) (jwt.MapClaims, error) {
+			return jwt.MapClaims{"username": form.Username, "id": 1}, nil
+		}))
+	require.NoError(t, err)
+	return f
+}
+
+func TestTraceIdInterceptor_StreamServe(t *testing.T) {
+	assert := require.New(t)
+	i := TraceIdInterceptor{}
+	md := metadata.New(map[string]string{string(xtrace.KeyName): "trace-1"})
+	stream := &fakeServerStream{ctx: metadata.NewIncomingContext(context.Background(), md)}
+	err := i.StreamServe(nil, stream, &grpc.StreamServerInfo{FullMethod: "/pkg.Service/Watch"}, func(srv interface{}, s grpc.ServerStream) error {
+		assert.Equal("trace-1", xtrace.GetTraceIDFromContext(s.Context()))
+		assert.NoError(s.SendMsg(1))
+		assert.NoError(s.RecvMsg(nil))
+		assert.NoError(s.SendMsg(2))
+		assert.Equal(int64(2), s.(*ServerStream).Sent())
+		assert.Equal(int64(1), s.(*ServerStream).Received())
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"trace-1"}, stream.header.Get(string(xtrace.KeyName)))
+}
+
+func TestTraceIdInterceptor_HandlerHeader(t *testing.T) {
+	assert := require.New(t)
+	i := TraceIdInterceptor{}
+	get := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &emptypb.Empty{}, grpc.SetHeader(ctx, metadata.Pairs("x-handler", "get"))
+	}
+	watch := func(srv interface{}, stream grpc.ServerStream) error {
+		if err := stream.RecvMsg(&emptypb.Empty{}); err != nil {
+			return err
+		}
+		if err := stream.SetHeader(metadata.Pairs("x-handler", "watch")); err != nil {
+			return err
+		}
+		return stream.SendMsg(&emptypb.Empty{})
+	}
+	conn := startTestServer(t, testServiceDesc(get, watch),
+		grpc.UnaryInterceptor(i.Serve), grpc.StreamInterceptor(i.StreamServe))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), string(xtrace.KeyName), "trace-1")
+
+	var header metadata.MD
+	assert.NoError(conn.Invoke(ctx, "/test.Service/Get", &emptypb.Empty{}, &emptypb.Empty{}, grpc.Header(&header)))
+	assert.Equal([]string{"get"}, header.Get("x-handler"))
+	assert.Equal([]string{"trace-1"}, header.Get(string(xtrace.KeyName)))
+
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, "/test.Service/Watch")
+	assert.NoError(err)
+	assert.NoError(stream.SendMsg(&emptypb.Empty{}))
+	assert.NoError(stream.CloseSend())
+	assert.NoError(stream.RecvMsg(&emptypb.Empty{}))
+	header, err = stream.Header()
+	assert.NoError(err)
+	assert.Equal([]string{"watch"}, header.Get("x-handler"))
+	assert.Equal([]string{"trace-1"}, header.Get(string(xtrace.KeyName)))
+}
+
+func TestJwtInterceptor_StreamServe(t *testing.T) {
+	assert := require.New(t)
+	factory := newJWTFactory(t)
+	i := NewJwtInterceptor(factory, map[string]bool{"/pkg.Service/Public": true})
+	handler := func(srv interface{}, s grpc.ServerStream) error {
+		return nil
+	}
+
+	stream := &fakeServerStream{ctx: context.Background()}
+	err := i.StreamServe(nil, stream, &grpc.StreamServerInfo{FullMethod: "/pkg.Service/Watch"}, handler)
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+	err = i.StreamServe(nil, stream, &grpc.StreamServerInfo{FullMethod: "/pkg.Service/Public"}, handler)
+	assert.NoError(err)
+
+	token, err := factory.GenerateToken(context.Background(), xjwt.LoginForm{Username: "stream", Password: "pass"})
+	assert.NoError(err)
+	md := metadata.New(map[string]string{headerAuthorize: token})
+	stream = &fakeServerStream{ctx: metadata.NewIncomingContext(context.Background(), md)}
+	err = i.StreamServe(nil, stream, &grpc.StreamServerInfo{FullMethod: "/pkg.Service/Watch"}, func(srv interface{}, s grpc.ServerStream) error {
+		assert.Equal("stream", xjwt.GetClaimsFromCtx(s.Context())["username"])
+		return nil
+	})
+	assert.NoError(err)
+}
+
+func TestRecoveryInterceptor_StreamServe(t *testing.T) {
+	assert := require.New(t)
+	i := RecoveryInterceptor{}
+	stream := &fakeServerStream{ctx: context.Background()}
+	err := i.StreamServe(nil, stream, &grpc.StreamServerInfo{FullMethod: "/pkg.Service/Watch"}, func(srv interface{}, s grpc.ServerStream) error {
+		panic("boom")
+	})
+	assert.Equal(codes.Internal, status.Code(err))
+}
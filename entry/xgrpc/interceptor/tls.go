@@ -0,0 +1,36 @@
+package interceptor
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/donech/tool/xtls"
+)
+
+// PeerIdentityInterceptor puts the verified client certificate of a mutual
+// TLS connection into the context, see xtls.GetIdentityFromCtx.
+type PeerIdentityInterceptor struct{}
+
+func (i *PeerIdentityInterceptor) Serve(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	return handler(identityCtx(ctx), req)
+}
+
+func (i *PeerIdentityInterceptor) StreamServe(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx := identityCtx(stream.Context())
+	return handler(srv, WrapServerStream(stream).WithContext(ctx))
+}
+
+func identityCtx(ctx context.Context) context.Context {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return ctx
+	}
+	return xtls.SetIdentityToCtx(ctx, xtls.NewIdentity(info.State.VerifiedChains[0][0]))
+}
@@ -24,6 +24,26 @@ func (s *TraceIdInterceptor) Serve(ctx context.Context, req interface{}, info *g
 		}
 	}()
 
+	ctx, header := s.traceCtx(ctx)
+	// SetHeader leaves the header open to the handler and inner interceptors
+	err = grpc.SetHeader(ctx, header)
+	if err != nil {
+		xlog.S(ctx).Errorf("grpc set header error %v", err)
+	}
+	return handler(ctx, req)
+}
+
+func (s *TraceIdInterceptor) StreamServe(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, header := s.traceCtx(stream.Context())
+	if err := stream.SetHeader(header); err != nil {
+		xlog.S(ctx).Errorf("grpc set header error %v", err)
+	}
+	return handler(srv, WrapServerStream(stream).WithContext(ctx))
+}
+
+// traceCtx reads the trace id from the incoming metadata or generates one,
+// it returns the context carrying it and the header to send back.
+func (s *TraceIdInterceptor) traceCtx(ctx context.Context) (context.Context, metadata.MD) {
 	var traceId string
 	// Read metadata from client.
 	md, ok := metadata.FromIncomingContext(ctx)
@@ -39,10 +59,5 @@ func (s *TraceIdInterceptor) Serve(ctx context.Context, req interface{}, info *g
 		traceId = xtrace.NewTraceID()
 	}
 	ctx = context.WithValue(ctx, xtrace.KeyName, traceId)
-	header := metadata.New(map[string]string{string(xtrace.KeyName): traceId})
-	err = grpc.SendHeader(ctx, header)
-	if err != nil {
-		xlog.S(ctx).Errorf("grpc send header error %v", err)
-	}
-	return handler(ctx, req)
+	return ctx, metadata.New(map[string]string{string(xtrace.KeyName): traceId})
 }
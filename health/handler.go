@@ -0,0 +1,50 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	HealthPath    = "/healthz"
+	ReadinessPath = "/readyz"
+	LivenessPath  = "/livez"
+)
+
+// HealthHandler serves the result of all checkers, 503 when any of them fails.
+func HealthHandler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, r.Check(req.Context()))
+	})
+}
+
+// ReadinessHandler is HealthHandler that fails as soon as the service starts shutting down.
+func ReadinessHandler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, r.Ready(req.Context()))
+	})
+}
+
+// LivenessHandler reports up as long as the process can serve http.
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, Report{Status: StatusUp})
+	})
+}
+
+// Mount registers the health, readiness and liveness handlers on mux.
+func Mount(mux *http.ServeMux, r *Registry) {
+	mux.Handle(HealthPath, HealthHandler(r))
+	mux.Handle(ReadinessPath, ReadinessHandler(r))
+	mux.Handle(LivenessPath, LivenessHandler())
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if report.Up() {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,204 @@
+// Package health keeps a registry of component checkers and reports the
+// health, readiness and liveness of a service.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+var ErrShuttingDown = errors.New("service is shutting down")
+
+var defaultTimeout = 3 * time.Second
+
+var defaultRegistry = NewRegistry()
+
+// Checker reports the health of a single component, nil means healthy.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// SQL checks a database/sql pool by pinging it, it works for the xdb gorm DB
+// through db.DB() and for ent/db named DBs.
+func SQL(db *sql.DB) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	})
+}
+
+// Report is the result of running the registered checkers.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func (r Report) Up() bool {
+	return r.Status == StatusUp
+}
+
+type Option func(registry *Registry)
+
+// WithTimeout bounds the time a single checker may take.
+func WithTimeout(d time.Duration) Option {
+	return func(registry *Registry) {
+		registry.timeout = d
+	}
+}
+
+// WithDrainDelay sets how long Drain keeps the service up after readiness
+// flips, giving load balancers time to stop routing new requests.
+func WithDrainDelay(d time.Duration) Option {
+	return func(registry *Registry) {
+		registry.drainDelay = d
+	}
+}
+
+func NewRegistry(options ...Option) *Registry {
+	r := &Registry{
+		checkers: make(map[string]Checker),
+		timeout:  defaultTimeout,
+	}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+type Registry struct {
+	mu         sync.RWMutex
+	checkers   map[string]Checker
+	timeout    time.Duration
+	drainDelay time.Duration
+	shutdown   int32
+}
+
+// Default returns the process wide registry used by the package level Register.
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Register adds a checker to the default registry.
+func Register(name string, checker Checker) {
+	defaultRegistry.Register(name, checker)
+}
+
+// Register adds or replaces the checker with the given name.
+func (r *Registry) Register(name string, checker Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkers[name] = checker
+}
+
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.checkers, name)
+}
+
+// Names returns the registered checker names in order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.checkers))
+	for name := range r.checkers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check runs all checkers concurrently, each one bounded by the registry timeout.
+func (r *Registry) Check(ctx context.Context) Report {
+	r.mu.RLock()
+	checkers := make(map[string]Checker, len(r.checkers))
+	for name, checker := range r.checkers {
+		checkers[name] = checker
+	}
+	r.mu.RUnlock()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]string, len(checkers))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, checker := range checkers {
+		wg.Add(1)
+		go func(name string, checker Checker) {
+			defer wg.Done()
+			err := r.check(ctx, checker)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				report.Status = StatusDown
+				report.Checks[name] = err.Error()
+				return
+			}
+			report.Checks[name] = StatusUp
+		}(name, checker)
+	}
+	wg.Wait()
+	return report
+}
+
+// CheckOne runs a single checker, found is false when no checker has that name.
+func (r *Registry) CheckOne(ctx context.Context, name string) (found bool, err error) {
+	r.mu.RLock()
+	checker, found := r.checkers[name]
+	r.mu.RUnlock()
+	if !found {
+		return false, nil
+	}
+	return true, r.check(ctx, checker)
+}
+
+func (r *Registry) check(ctx context.Context, checker Checker) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return checker.Check(ctx)
+}
+
+// Ready is Check that reports down as soon as Shutdown has been called.
+func (r *Registry) Ready(ctx context.Context) Report {
+	if r.IsShutdown() {
+		return Report{Status: StatusDown, Checks: map[string]string{"shutdown": ErrShuttingDown.Error()}}
+	}
+	return r.Check(ctx)
+}
+
+// Shutdown flips readiness to down, it returns false if it was already down.
+func (r *Registry) Shutdown() bool {
+	return atomic.CompareAndSwapInt32(&r.shutdown, 0, 1)
+}
+
+func (r *Registry) IsShutdown() bool {
+	return atomic.LoadInt32(&r.shutdown) == 1
+}
+
+// Drain flips readiness to down and, for the first caller only, waits for
+// the drain delay or ctx so that load balancers stop sending new requests
+// before servers shut down.
+func (r *Registry) Drain(ctx context.Context) {
+	if !r.Shutdown() || r.drainDelay <= 0 {
+		return
+	}
+	t := time.NewTimer(r.drainDelay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,78 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Check(t *testing.T) {
+	assert := require.New(t)
+	r := NewRegistry(WithTimeout(50 * time.Millisecond))
+	r.Register("db", CheckerFunc(func(ctx context.Context) error { return nil }))
+	report := r.Check(context.Background())
+	assert.True(report.Up())
+	assert.Equal(map[string]string{"db": StatusUp}, report.Checks)
+
+	r.Register("redis", CheckerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	report = r.Check(context.Background())
+	assert.False(report.Up())
+	assert.Equal(context.DeadlineExceeded.Error(), report.Checks["redis"])
+	assert.Equal([]string{"db", "redis"}, r.Names())
+
+	found, err := r.CheckOne(context.Background(), "db")
+	assert.True(found)
+	assert.NoError(err)
+	found, _ = r.CheckOne(context.Background(), "mq")
+	assert.False(found)
+}
+
+func TestRegistry_Drain(t *testing.T) {
+	assert := require.New(t)
+	r := NewRegistry(WithDrainDelay(20 * time.Millisecond))
+	assert.True(r.Ready(context.Background()).Up())
+
+	start := time.Now()
+	r.Drain(context.Background())
+	assert.True(time.Since(start) >= 20*time.Millisecond)
+	assert.False(r.Ready(context.Background()).Up())
+	assert.True(r.Check(context.Background()).Up())
+
+	start = time.Now()
+	r.Drain(context.Background())
+	assert.True(time.Since(start) < 20*time.Millisecond)
+}
+
+func TestHandlers(t *testing.T) {
+	assert := require.New(t)
+	r := NewRegistry()
+	mux := http.NewServeMux()
+	Mount(mux, r)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	assert.Equal(http.StatusOK, serve(HealthPath).Code)
+	assert.Equal(http.StatusOK, serve(ReadinessPath).Code)
+
+	r.Register("db", CheckerFunc(func(ctx context.Context) error { return errors.New("connection refused") }))
+	w := serve(HealthPath)
+	assert.Equal(http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(`{"status":"down","checks":{"db":"connection refused"}}`, w.Body.String())
+
+	r.Unregister("db")
+	r.Shutdown()
+	assert.Equal(http.StatusOK, serve(HealthPath).Code)
+	assert.Equal(http.StatusServiceUnavailable, serve(ReadinessPath).Code)
+	assert.Equal(http.StatusOK, serve(LivenessPath).Code)
+}
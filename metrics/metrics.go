@@ -0,0 +1,106 @@
+// Package metrics collects request metrics of the gin and grpc entries and
+// exposes them, together with db and redis pool stats, in the Prometheus
+// text format.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const DefaultPath = "/metrics"
+
+const (
+	EntryHTTP = "http"
+	EntryGRPC = "grpc"
+)
+
+// New creates a Metrics with its own registry, which also collects the Go
+// runtime and process metrics. namespace prefixes every metric name.
+func New(namespace string) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		HTTPRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Total number of http requests by route template, method and status.",
+		}, []string{"route", "method", "status"}),
+		HTTPDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of http requests by route template, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		HTTPInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "Number of http requests being served.",
+		}),
+		GRPCRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grpc_server_handled_total",
+			Help:      "Total number of grpc calls by full method and code.",
+		}, []string{"method", "code"}),
+		GRPCDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "grpc_server_handling_seconds",
+			Help:      "Latency of grpc calls by full method and code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "code"}),
+		GRPCInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "grpc_server_in_flight",
+			Help:      "Number of grpc calls being served.",
+		}),
+		Panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "panics_total",
+			Help:      "Total number of panics recovered by entry.",
+		}, []string{"entry"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.HTTPRequests, m.HTTPDuration, m.HTTPInFlight,
+		m.GRPCRequests, m.GRPCDuration, m.GRPCInFlight,
+		m.Panics,
+	)
+	return m
+}
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	HTTPRequests *prometheus.CounterVec
+	HTTPDuration *prometheus.HistogramVec
+	HTTPInFlight prometheus.Gauge
+
+	GRPCRequests *prometheus.CounterVec
+	GRPCDuration *prometheus.HistogramVec
+	GRPCInFlight prometheus.Gauge
+
+	Panics *prometheus.CounterVec
+}
+
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// MustRegister adds collectors such as xdb.Collector, db.Collector or redis.Collector.
+func (m *Metrics) MustRegister(cs ...prometheus.Collector) {
+	m.registry.MustRegister(cs...)
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// SQL collects the pool stats of a database/sql DB under the db_name label.
+func SQL(name string, db *sql.DB) prometheus.Collector {
+	return collectors.NewDBStatsCollector(db, name)
+}
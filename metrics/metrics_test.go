@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedis(t *testing.T) {
+	assert := require.New(t)
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+	defer client.Close()
+
+	m := New("test")
+	m.MustRegister(Redis("default", client))
+	assert.Equal(6, testutil.CollectAndCount(Redis("default", client)))
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, DefaultPath, nil))
+	assert.Contains(w.Body.String(), `go_redis_pool_total_connections{redis_name="default"} 0`)
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Redis collects the pool stats of a redis client under the redis_name label.
+func Redis(name string, client *redis.Client) prometheus.Collector {
+	labels := prometheus.Labels{"redis_name": name}
+	return &redisCollector{
+		client: client,
+		hits: prometheus.NewDesc("go_redis_pool_hits_total",
+			"Number of times a free connection was found in the pool.", nil, labels),
+		misses: prometheus.NewDesc("go_redis_pool_misses_total",
+			"Number of times a free connection was not found in the pool.", nil, labels),
+		timeouts: prometheus.NewDesc("go_redis_pool_timeouts_total",
+			"Number of times a wait timeout occurred.", nil, labels),
+		totalConns: prometheus.NewDesc("go_redis_pool_total_connections",
+			"Number of total connections in the pool.", nil, labels),
+		idleConns: prometheus.NewDesc("go_redis_pool_idle_connections",
+			"Number of idle connections in the pool.", nil, labels),
+		staleConns: prometheus.NewDesc("go_redis_pool_stale_connections_total",
+			"Number of stale connections removed from the pool.", nil, labels),
+	}
+}
+
+type redisCollector struct {
+	client     *redis.Client
+	hits       *prometheus.Desc
+	misses     *prometheus.Desc
+	timeouts   *prometheus.Desc
+	totalConns *prometheus.Desc
+	idleConns  *prometheus.Desc
+	staleConns *prometheus.Desc
+}
+
+func (c *redisCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.timeouts
+	ch <- c.totalConns
+	ch <- c.idleConns
+	ch <- c.staleConns
+}
+
+func (c *redisCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.client.PoolStats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(c.staleConns, prometheus.CounterValue, float64(stats.StaleConns))
+}
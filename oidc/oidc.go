@@ -0,0 +1,285 @@
+// Package oidc signs users in with an OpenID Connect provider through the
+// authorization code flow with PKCE, so that their identity can be exchanged
+// for a token of our own xjwt.JWTFactory.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/donech/tool/xjwt"
+)
+
+// DiscoveryPath is where a provider publishes its configuration, relative to the issuer.
+const DiscoveryPath = "/.well-known/openid-configuration"
+
+var (
+	ErrInvalidNonce = errors.New("oidc: id token nonce mismatch")
+	ErrNoIDToken    = errors.New("oidc: token response has no id_token")
+	// ErrNoSigningAlgorithm the provider supports no id token algorithm that
+	// verifies with its public keys.
+	ErrNoSigningAlgorithm = errors.New("oidc: provider supports no asymmetric id token algorithm")
+)
+
+type Config struct {
+	// Issuer of the provider, its configuration is discovered from Issuer + DiscoveryPath.
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"clientId"`
+	ClientSecret string `yaml:"clientSecret"`
+	RedirectURL  string `yaml:"redirectUrl"`
+	// Scopes default openid profile email.
+	Scopes []string `yaml:"scopes"`
+	// Algorithm of id tokens, default RS256 or else the first asymmetric one the provider supports.
+	Algorithm string `yaml:"algorithm"`
+	// Leeway tolerated clock skew when checking id tokens, e.g. 30s.
+	Leeway string `yaml:"leeway"`
+	// JWKSCacheTTL how long the provider keys are cached, default 10m.
+	JWKSCacheTTL string `yaml:"jwksCacheTtl"`
+}
+
+// Discovery is the part of the provider configuration the flow needs.
+type Discovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	SigningAlgorithms     []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// Token is the token endpoint response.
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	IDToken      string `json:"id_token"`
+}
+
+// AuthRequest is the per login secret state, it is kept by the browser
+// between the redirect to the provider and the callback.
+type AuthRequest struct {
+	State string
+	Nonce string
+	// Verifier is the PKCE code verifier, only its S256 challenge leaves the server.
+	Verifier string
+}
+
+// NewAuthRequest generates random state, nonce and code verifier.
+func NewAuthRequest() (AuthRequest, error) {
+	values := make([]string, 3)
+	for i := range values {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return AuthRequest{}, err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return AuthRequest{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// ClaimsMapper turns the claims of a verified id token into the claims of our
+// own token, e.g. by looking up or creating the local user.
+type ClaimsMapper func(ctx context.Context, idClaims jwt.MapClaims) (jwt.MapClaims, error)
+
+// DefaultClaimsMapper keeps sub, email, email_verified, name and preferred_username.
+func DefaultClaimsMapper(ctx context.Context, idClaims jwt.MapClaims) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	for _, name := range []string{"sub", "email", "email_verified", "name", "preferred_username"} {
+		if v, ok := idClaims[name]; ok {
+			claims[name] = v
+		}
+	}
+	return claims, nil
+}
+
+type Client struct {
+	conf      Config
+	http      *http.Client
+	discovery Discovery
+	verifier  *xjwt.JWTFactory
+}
+
+// NewClient discovers the provider of conf, a nil httpClient uses a client
+// with a 10s timeout.
+func NewClient(ctx context.Context, conf Config, httpClient *http.Client) (*Client, error) {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(conf.Scopes) == 0 {
+		conf.Scopes = []string{"openid", "profile", "email"}
+	}
+	c := &Client{conf: conf, http: httpClient}
+	if err := c.discover(ctx); err != nil {
+		return nil, err
+	}
+	alg := conf.Algorithm
+	if alg == "" {
+		var err error
+		if alg, err = signingAlgorithm(c.discovery.SigningAlgorithms); err != nil {
+			return nil, err
+		}
+	}
+	var ttl time.Duration
+	if conf.JWKSCacheTTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(conf.JWKSCacheTTL); err != nil {
+			return nil, err
+		}
+	}
+	verifier, err := xjwt.NewJWTFactory(xjwt.Config{
+		SingingAlgorithm: alg,
+		Issuer:           c.discovery.Issuer,
+		Audience:         []string{conf.ClientID},
+		Leeway:           conf.Leeway,
+	}, xjwt.WithKeyProvider(xjwt.NewRemoteKeySet(c.discovery.JWKSURI, ttl, httpClient)))
+	if err != nil {
+		return nil, err
+	}
+	c.verifier = verifier
+	return c, nil
+}
+
+// signingAlgorithm picks the id token algorithm among the supported ones the
+// provider keys can verify, RS256 first as every provider must support it.
+func signingAlgorithm(supported []string) (string, error) {
+	if len(supported) == 0 {
+		return "RS256", nil
+	}
+	alg := ""
+	for _, a := range supported {
+		switch a {
+		case "RS256":
+			return a, nil
+		case "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA":
+			if alg == "" {
+				alg = a
+			}
+		}
+	}
+	if alg == "" {
+		return "", ErrNoSigningAlgorithm
+	}
+	return alg, nil
+}
+
+func (c *Client) discover(ctx context.Context) error {
+	issuer := strings.TrimSuffix(c.conf.Issuer, "/")
+	req, err := http.NewRequest(http.MethodGet, issuer+DiscoveryPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("oidc: discover %s: %w", issuer, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: discover %s: unexpected status %d", issuer, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&c.discovery); err != nil {
+		return fmt.Errorf("oidc: discover %s: %w", issuer, err)
+	}
+	if strings.TrimSuffix(c.discovery.Issuer, "/") != issuer {
+		return fmt.Errorf("oidc: discovered issuer %s does not match %s", c.discovery.Issuer, issuer)
+	}
+	return nil
+}
+
+// Discovery returns the discovered provider configuration.
+func (c *Client) Discovery() Discovery {
+	return c.discovery
+}
+
+// AuthCodeURL returns the provider url the browser is redirected to.
+func (c *Client) AuthCodeURL(req AuthRequest) string {
+	challenge := sha256.Sum256([]byte(req.Verifier))
+	v := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.conf.ClientID},
+		"redirect_uri":          {c.conf.RedirectURL},
+		"scope":                 {strings.Join(c.conf.Scopes, " ")},
+		"state":                 {req.State},
+		"nonce":                 {req.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(c.discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return c.discovery.AuthorizationEndpoint + sep + v.Encode()
+}
+
+// Exchange redeems the authorization code with the PKCE verifier.
+func (c *Client) Exchange(ctx context.Context, code, verifier string) (Token, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.conf.RedirectURL},
+		"client_id":     {c.conf.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, c.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.conf.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.conf.ClientID), url.QueryEscape(c.conf.ClientSecret))
+	}
+	resp, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return Token{}, fmt.Errorf("oidc: exchange code: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Token{}, fmt.Errorf("oidc: exchange code: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Token{}, fmt.Errorf("oidc: exchange code: unexpected status %d: %s", resp.StatusCode, body)
+	}
+	token := Token{}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return Token{}, fmt.Errorf("oidc: exchange code: %w", err)
+	}
+	if token.IDToken == "" {
+		return Token{}, ErrNoIDToken
+	}
+	return token, nil
+}
+
+// VerifyIDToken checks the signature of an id token against the provider
+// JWKS, its iss, aud, exp and nonce, and returns its claims.
+func (c *Client) VerifyIDToken(ctx context.Context, idToken, nonce string) (jwt.MapClaims, error) {
+	claims, err := c.verifier.GetClaimsContext(ctx, idToken)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: verify id token: %w", err)
+	}
+	if got, _ := claims["nonce"].(string); nonce == "" || got != nonce {
+		return nil, ErrInvalidNonce
+	}
+	return claims, nil
+}
+
+// Callback exchanges code and verifies the id token of the response.
+func (c *Client) Callback(ctx context.Context, code string, req AuthRequest) (jwt.MapClaims, error) {
+	token, err := c.Exchange(ctx, code, req.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	return c.VerifyIDToken(ctx, token.IDToken, req.Nonce)
+}
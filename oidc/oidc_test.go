@@ -0,0 +1,113 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/donech/tool/oidc"
+	"github.com/donech/tool/oidc/oidctest"
+	"github.com/donech/tool/xjwt"
+)
+
+// authorize follows the redirect to the provider and returns the code it sends back.
+func authorize(t *testing.T, client *oidc.Client, req oidc.AuthRequest) string {
+	httpClient := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := httpClient.Get(client.AuthCodeURL(req))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, req.State, location.Query().Get("state"))
+	return location.Query().Get("code")
+}
+
+func TestClient_Callback(t *testing.T) {
+	assert := require.New(t)
+	provider, err := oidctest.NewProvider("client", "secret")
+	assert.NoError(err)
+	defer provider.Close()
+	ctx := context.Background()
+	client, err := oidc.NewClient(ctx, oidc.Config{
+		Issuer:       provider.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "https://app.example.com/callback",
+	}, nil)
+	assert.NoError(err)
+	assert.Equal(provider.URL+"/token", client.Discovery().TokenEndpoint)
+
+	req, err := oidc.NewAuthRequest()
+	assert.NoError(err)
+	claims, err := client.Callback(ctx, authorize(t, client, req), req)
+	assert.NoError(err)
+	assert.Equal("oidc-user", claims["sub"])
+	mapped, err := oidc.DefaultClaimsMapper(ctx, claims)
+	assert.NoError(err)
+	assert.Equal(jwt.MapClaims{"sub": "oidc-user", "email": "user@example.com"}, mapped)
+
+	// a code redeems once and only with its verifier
+	code := authorize(t, client, req)
+	_, err = client.Callback(ctx, code, oidc.AuthRequest{Nonce: req.Nonce, Verifier: "wrong"})
+	assert.Error(err)
+	_, err = client.Callback(ctx, code, req)
+	assert.Error(err)
+
+	_, err = client.Callback(ctx, authorize(t, client, req), oidc.AuthRequest{Nonce: "other", Verifier: req.Verifier})
+	assert.Equal(oidc.ErrInvalidNonce, err)
+
+	// an id token issued to another client is rejected
+	idToken, err := provider.SignIDToken(jwt.MapClaims{"sub": "oidc-user", "nonce": req.Nonce})
+	assert.NoError(err)
+	_, err = client.VerifyIDToken(ctx, idToken, req.Nonce)
+	assert.NoError(err)
+	other, err := oidc.NewClient(ctx, oidc.Config{Issuer: provider.URL, ClientID: "other"}, nil)
+	assert.NoError(err)
+	_, err = other.VerifyIDToken(ctx, idToken, req.Nonce)
+	assert.True(errors.Is(err, xjwt.ErrInvalidAudience))
+}
+
+func TestNewClient_UnknownIssuer(t *testing.T) {
+	provider, err := oidctest.NewProvider("client", "secret")
+	require.NoError(t, err)
+	defer provider.Close()
+	_, err = oidc.NewClient(context.Background(), oidc.Config{Issuer: provider.URL + "/tenant", ClientID: "client"}, nil)
+	require.Error(t, err)
+}
+
+func TestNewClient_SigningAlgorithm(t *testing.T) {
+	assert := require.New(t)
+	provider, err := oidctest.NewProvider("client", "secret")
+	assert.NoError(err)
+	defer provider.Close()
+	ctx := context.Background()
+	conf := oidc.Config{Issuer: provider.URL, ClientID: "client", ClientSecret: "secret"}
+
+	// symmetric algorithms are skipped, the provider keys can't verify them
+	provider.SigningAlgorithms = []string{"HS256", "none", "ES256"}
+	client, err := oidc.NewClient(ctx, conf, nil)
+	assert.NoError(err)
+	idToken, err := provider.SignIDToken(jwt.MapClaims{"sub": "oidc-user", "nonce": "n"})
+	assert.NoError(err)
+	_, err = client.VerifyIDToken(ctx, idToken, "n")
+	assert.NoError(err)
+
+	// RS256 is preferred whatever its position
+	provider.SigningAlgorithms = []string{"ES256", "RS256"}
+	client, err = oidc.NewClient(ctx, conf, nil)
+	assert.NoError(err)
+	_, err = client.VerifyIDToken(ctx, idToken, "n")
+	assert.True(errors.Is(err, xjwt.ErrAlgorithmMismatch))
+
+	provider.SigningAlgorithms = []string{"HS256", "none"}
+	_, err = oidc.NewClient(ctx, conf, nil)
+	assert.Equal(oidc.ErrNoSigningAlgorithm, err)
+}
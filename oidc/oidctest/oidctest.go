@@ -0,0 +1,160 @@
+// Package oidctest runs a fake OpenID Connect provider for tests.
+package oidctest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/donech/tool/oidc"
+	"github.com/donech/tool/xjwt"
+)
+
+type authorization struct {
+	nonce       string
+	challenge   string
+	redirectURI string
+}
+
+// Provider issues ES256 id tokens for the single client ClientID. Its
+// authorization endpoint approves every request at once.
+type Provider struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	// Claims are put into every id token besides iss, aud, exp and nonce.
+	Claims jwt.MapClaims
+	// SigningAlgorithms are advertised in the discovery, id tokens are signed with ES256 whatever they are.
+	SigningAlgorithms []string
+
+	signer *xjwt.JWTFactory
+	mu     sync.Mutex
+	codes  map[string]authorization
+}
+
+// NewProvider starts a provider, Close it when done.
+func NewProvider(clientID, clientSecret string) (*Provider, error) {
+	p := &Provider{
+		ClientID:          clientID,
+		ClientSecret:      clientSecret,
+		Claims:            jwt.MapClaims{"sub": "oidc-user", "email": "user@example.com"},
+		SigningAlgorithms: []string{"ES256"},
+		codes:             map[string]authorization{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(oidc.DiscoveryPath, p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	p.signer, err = xjwt.NewJWTFactory(xjwt.Config{
+		SingingAlgorithm: "ES256",
+		Issuer:           p.URL,
+		Audience:         []string{clientID},
+		Timeout:          "5m",
+	}, xjwt.WithPrivateKey(key))
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	mux.Handle(xjwt.JWKSPath, xjwt.JWKSHandler(p.signer.KeySet()))
+	return p, nil
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, oidc.Discovery{
+		Issuer:                p.URL,
+		AuthorizationEndpoint: p.URL + "/authorize",
+		TokenEndpoint:         p.URL + "/token",
+		JWKSURI:               p.URL + xjwt.JWKSPath,
+		SigningAlgorithms:     p.SigningAlgorithms,
+	})
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != p.ClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = authorization{nonce: q.Get("nonce"), challenge: q.Get("code_challenge"), redirectURI: q.Get("redirect_uri")}
+	p.mu.Unlock()
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	v := redirect.Query()
+	v.Set("code", code)
+	v.Set("state", q.Get("state"))
+	redirect.RawQuery = v.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+	if id != p.ClientID || secret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	code := r.PostFormValue("code")
+	p.mu.Lock()
+	auth, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" ||
+		r.PostFormValue("redirect_uri") != auth.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	claims := jwt.MapClaims{}
+	for k, v := range p.Claims {
+		claims[k] = v
+	}
+	if auth.nonce != "" {
+		claims["nonce"] = auth.nonce
+	}
+	idToken, err := p.signer.GenerateTokenWithClaims(claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, oidc.Token{AccessToken: randomString(), TokenType: "Bearer", ExpiresIn: 300, IDToken: idToken})
+}
+
+// SignIDToken signs claims with the provider key, for forging tokens in tests.
+func (p *Provider) SignIDToken(claims jwt.MapClaims) (string, error) {
+	return p.signer.GenerateTokenWithClaims(claims)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
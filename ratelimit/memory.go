@@ -0,0 +1,153 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval how often idle keys are dropped from the memory limiters.
+var sweepInterval = time.Minute
+
+// NewTokenBucket refills limit tokens per period into a bucket holding at most
+// burst tokens, burst defaults to limit.
+func NewTokenBucket(limit int, period time.Duration, burst int) *MemoryTokenBucket {
+	if burst <= 0 {
+		burst = limit
+	}
+	return &MemoryTokenBucket{
+		limit:   limit,
+		burst:   burst,
+		rate:    float64(limit) / period.Seconds(),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type MemoryTokenBucket struct {
+	mu        sync.Mutex
+	limit     int
+	burst     int
+	rate      float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func (l *MemoryTokenBucket) Allow(ctx context.Context, key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return Result{Allowed: true, Limit: l.limit, Remaining: int(b.tokens)}, nil
+	}
+	retryAfter := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return Result{Limit: l.limit, RetryAfter: retryAfter}, nil
+}
+
+// sweep drops buckets that have been refilled completely.
+func (l *MemoryTokenBucket) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// NewSlidingWindow allows limit requests in any period long window. It uses
+// the sliding window counter approximation: the count of the previous fixed
+// window weighted by its overlap plus the count of the current one.
+func NewSlidingWindow(limit int, period time.Duration) *MemorySlidingWindow {
+	return &MemorySlidingWindow{
+		limit:   limit,
+		period:  period,
+		windows: make(map[string]*window),
+		now:     time.Now,
+	}
+}
+
+type window struct {
+	start time.Time
+	prev  int
+	curr  int
+}
+
+type MemorySlidingWindow struct {
+	mu        sync.Mutex
+	limit     int
+	period    time.Duration
+	windows   map[string]*window
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func (l *MemorySlidingWindow) Allow(ctx context.Context, key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+	start := now.Truncate(l.period)
+	w, ok := l.windows[key]
+	if !ok {
+		w = &window{start: start}
+		l.windows[key] = w
+	}
+	switch {
+	case start.Sub(w.start) >= 2*l.period:
+		w.start, w.prev, w.curr = start, 0, 0
+	case start.After(w.start):
+		w.start, w.prev, w.curr = start, w.curr, 0
+	}
+
+	elapsed := now.Sub(w.start)
+	weight := 1 - float64(elapsed)/float64(l.period)
+	count := float64(w.prev)*weight + float64(w.curr)
+	if count+1 <= float64(l.limit) {
+		w.curr++
+		return Result{Allowed: true, Limit: l.limit, Remaining: int(float64(l.limit) - count - 1)}, nil
+	}
+
+	// wait until the weighted previous window has decayed enough, or until
+	// the next window when the current one is full on its own.
+	retryAfter := l.period - elapsed
+	if w.prev > 0 && w.curr+1 <= l.limit {
+		need := 1 - float64(l.limit-w.curr-1)/float64(w.prev)
+		retryAfter = time.Duration(need*float64(l.period)) - elapsed
+	}
+	if retryAfter < time.Millisecond {
+		retryAfter = time.Millisecond
+	}
+	return Result{Limit: l.limit, RetryAfter: retryAfter}, nil
+}
+
+// sweep drops windows that no longer weigh in the count.
+func (l *MemorySlidingWindow) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= 2*l.period {
+			delete(l.windows, key)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Package ratelimit provides token bucket and sliding window limiters backed
+// by memory or redis.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/donech/tool/redis"
+)
+
+const (
+	TokenBucket   = "token_bucket"
+	SlidingWindow = "sliding_window"
+
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// Result is the decision for a single request.
+type Result struct {
+	Allowed bool
+	// Limit configured number of requests per period.
+	Limit int
+	// Remaining requests left right now.
+	Remaining int
+	// RetryAfter how long to wait before the next request may be allowed, 0 when Allowed.
+	RetryAfter time.Duration
+}
+
+// Limiter decides whether the request identified by key may proceed.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Result, error)
+}
+
+type Config struct {
+	// Algorithm token_bucket or sliding_window, default token_bucket.
+	Algorithm string `yaml:"algorithm"`
+	// Limit requests allowed per Period.
+	Limit int `yaml:"limit"`
+	// Period default 1s.
+	Period time.Duration `yaml:"period"`
+	// Burst token bucket capacity, default Limit.
+	Burst int `yaml:"burst"`
+	// Backend memory or redis, default memory.
+	Backend string `yaml:"backend"`
+	// RedisName name of the client registered through redis.New, default redis.Default.
+	RedisName string `yaml:"redisName"`
+	// KeyPrefix prefix of redis keys, default ratelimit:.
+	KeyPrefix string `yaml:"keyPrefix"`
+}
+
+// New builds a Limiter from conf, the redis backend uses redis.Redis(conf.RedisName).
+func New(conf Config) (Limiter, error) {
+	if conf.Limit <= 0 {
+		return nil, fmt.Errorf("ratelimit: limit must be positive, got %d", conf.Limit)
+	}
+	if conf.Period <= 0 {
+		conf.Period = time.Second
+	}
+	if conf.Algorithm == "" {
+		conf.Algorithm = TokenBucket
+	}
+	switch conf.Backend {
+	case "", BackendMemory:
+		switch conf.Algorithm {
+		case TokenBucket:
+			return NewTokenBucket(conf.Limit, conf.Period, conf.Burst), nil
+		case SlidingWindow:
+			return NewSlidingWindow(conf.Limit, conf.Period), nil
+		}
+	case BackendRedis:
+		name := conf.RedisName
+		if name == "" {
+			name = redis.Default
+		}
+		client := redis.Redis(name)
+		switch conf.Algorithm {
+		case TokenBucket:
+			return NewRedisTokenBucket(client, conf.KeyPrefix, conf.Limit, conf.Period, conf.Burst), nil
+		case SlidingWindow:
+			return NewRedisSlidingWindow(client, conf.KeyPrefix, conf.Limit, conf.Period), nil
+		}
+	default:
+		return nil, fmt.Errorf("ratelimit: unknown backend %s", conf.Backend)
+	}
+	return nil, fmt.Errorf("ratelimit: unknown algorithm %s", conf.Algorithm)
+}
@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestMemoryTokenBucket(t *testing.T) {
+	assert := require.New(t)
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	l := NewTokenBucket(2, time.Second, 3)
+	l.now = clock.Now
+	ctx := context.Background()
+
+	for i := 2; i >= 0; i-- {
+		res, err := l.Allow(ctx, "ip")
+		assert.NoError(err)
+		assert.True(res.Allowed)
+		assert.Equal(i, res.Remaining)
+	}
+	res, _ := l.Allow(ctx, "ip")
+	assert.False(res.Allowed)
+	assert.Equal(500*time.Millisecond, res.RetryAfter)
+
+	res, _ = l.Allow(ctx, "other")
+	assert.True(res.Allowed)
+
+	clock.Add(500 * time.Millisecond)
+	res, _ = l.Allow(ctx, "ip")
+	assert.True(res.Allowed)
+	res, _ = l.Allow(ctx, "ip")
+	assert.False(res.Allowed)
+}
+
+func TestMemorySlidingWindow(t *testing.T) {
+	assert := require.New(t)
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	l := NewSlidingWindow(4, time.Second)
+	l.now = clock.Now
+	ctx := context.Background()
+
+	for i := 3; i >= 0; i-- {
+		res, err := l.Allow(ctx, "ip")
+		assert.NoError(err)
+		assert.True(res.Allowed)
+		assert.Equal(i, res.Remaining)
+	}
+	res, _ := l.Allow(ctx, "ip")
+	assert.False(res.Allowed)
+	assert.Equal(time.Second, res.RetryAfter)
+
+	// a quarter into the next window the previous 4 requests still weigh 3.
+	clock.Add(1250 * time.Millisecond)
+	res, _ = l.Allow(ctx, "ip")
+	assert.True(res.Allowed)
+	res, _ = l.Allow(ctx, "ip")
+	assert.False(res.Allowed)
+	assert.Equal(250*time.Millisecond, res.RetryAfter)
+
+	clock.Add(2 * time.Second)
+	res, _ = l.Allow(ctx, "ip")
+	assert.True(res.Allowed)
+	assert.Equal(3, res.Remaining)
+}
+
+func TestNew(t *testing.T) {
+	assert := require.New(t)
+	l, err := New(Config{Limit: 10})
+	assert.NoError(err)
+	assert.IsType(&MemoryTokenBucket{}, l)
+	l, err = New(Config{Limit: 10, Algorithm: SlidingWindow})
+	assert.NoError(err)
+	assert.IsType(&MemorySlidingWindow{}, l)
+	_, err = New(Config{Limit: 10, Algorithm: "leaky"})
+	assert.Error(err)
+	_, err = New(Config{})
+	assert.Error(err)
+}
+
+func newRedisClient(t *testing.T) *goredis.Client {
+	client := goredis.NewClient(&goredis.Options{Addr: ":6379"})
+	if err := client.Ping().Err(); err != nil {
+		client.Close()
+		t.Skip("redis is not available: ", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestRedisLimiters(t *testing.T) {
+	client := newRedisClient(t)
+	key := "test-" + time.Now().Format(time.RFC3339Nano)
+	for name, l := range map[string]Limiter{
+		"token_bucket":   NewRedisTokenBucket(client, "", 2, time.Minute, 0),
+		"sliding_window": NewRedisSlidingWindow(client, "", 2, time.Minute),
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert := require.New(t)
+			ctx := context.Background()
+			for i := 1; i >= 0; i-- {
+				res, err := l.Allow(ctx, name+key)
+				assert.NoError(err)
+				assert.True(res.Allowed)
+				assert.Equal(i, res.Remaining)
+			}
+			res, err := l.Allow(ctx, name+key)
+			assert.NoError(err)
+			assert.False(res.Allowed)
+			assert.True(res.RetryAfter > 0)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strconv"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+)
+
+var defaultKeyPrefix = "ratelimit:"
+
+var errUnexpectedReply = errors.New("ratelimit: unexpected redis reply")
+
+// tokenBucketScript keeps tokens and the last refill time in a hash.
+var tokenBucketScript = goredis.NewScript(`
+local rate = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(b[1]) or capacity
+local ts = tonumber(b[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry = math.ceil((1 - tokens) / rate)
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {allowed, math.floor(tokens), retry}
+`)
+
+// slidingWindowScript keeps one sorted set member per allowed request.
+var slidingWindowScript = goredis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], 0, now - window)
+local count = redis.call('ZCARD', KEYS[1])
+if count < limit then
+  redis.call('ZADD', KEYS[1], now, ARGV[4])
+  redis.call('PEXPIRE', KEYS[1], window)
+  return {1, limit - count - 1, 0}
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return {0, 0, tonumber(oldest[2]) + window - now}
+`)
+
+// NewRedisTokenBucket is NewTokenBucket shared by all instances through redis.
+// Time comes from the callers, so their clocks should be in sync.
+func NewRedisTokenBucket(client *goredis.Client, prefix string, limit int, period time.Duration, burst int) *RedisTokenBucket {
+	if burst <= 0 {
+		burst = limit
+	}
+	if prefix == "" {
+		prefix = defaultKeyPrefix
+	}
+	return &RedisTokenBucket{client: client, prefix: prefix, limit: limit, period: period, burst: burst}
+}
+
+type RedisTokenBucket struct {
+	client *goredis.Client
+	prefix string
+	limit  int
+	period time.Duration
+	burst  int
+}
+
+func (l *RedisTokenBucket) Allow(ctx context.Context, key string) (Result, error) {
+	rate := float64(l.limit) / float64(l.period.Milliseconds())
+	ttl := int64(float64(l.burst)/rate) + 1000
+	res, err := tokenBucketScript.Run(l.client.WithContext(ctx), []string{l.prefix + key},
+		rate, l.burst, nowMillis(), ttl).Result()
+	if err != nil {
+		return Result{}, err
+	}
+	return toResult(res, l.limit)
+}
+
+// NewRedisSlidingWindow is a sliding log limiter shared by all instances
+// through redis. Time comes from the callers, so their clocks should be in sync.
+func NewRedisSlidingWindow(client *goredis.Client, prefix string, limit int, period time.Duration) *RedisSlidingWindow {
+	if prefix == "" {
+		prefix = defaultKeyPrefix
+	}
+	return &RedisSlidingWindow{client: client, prefix: prefix, limit: limit, period: period}
+}
+
+type RedisSlidingWindow struct {
+	client *goredis.Client
+	prefix string
+	limit  int
+	period time.Duration
+}
+
+func (l *RedisSlidingWindow) Allow(ctx context.Context, key string) (Result, error) {
+	now := nowMillis()
+	member := strconv.FormatInt(now, 10) + "-" + strconv.FormatUint(rand.Uint64(), 36)
+	res, err := slidingWindowScript.Run(l.client.WithContext(ctx), []string{l.prefix + key},
+		l.limit, l.period.Milliseconds(), now, member).Result()
+	if err != nil {
+		return Result{}, err
+	}
+	return toResult(res, l.limit)
+}
+
+func toResult(res interface{}, limit int) (Result, error) {
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 3 {
+		return Result{}, errUnexpectedReply
+	}
+	allowed, _ := values[0].(int64)
+	remaining, _ := values[1].(int64)
+	retry, _ := values[2].(int64)
+	return Result{
+		Allowed:    allowed == 1,
+		Limit:      limit,
+		Remaining:  int(remaining),
+		RetryAfter: time.Duration(retry) * time.Millisecond,
+	}, nil
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
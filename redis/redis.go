@@ -4,8 +4,11 @@ import (
 	"context"
 	"sync"
 
+	"github.com/donech/tool/health"
+	"github.com/donech/tool/metrics"
 	"github.com/donech/tool/xlog"
 	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const Default = "default"
@@ -44,3 +47,20 @@ func Redis(name ...string) *redis.Client {
 
 	return v.(*redis.Client)
 }
+
+// Checker returns a health.Checker that pings the named redis client.
+func Checker(name ...string) health.Checker {
+	client := Redis(name...)
+	return health.CheckerFunc(func(ctx context.Context) error {
+		return client.WithContext(ctx).Ping().Err()
+	})
+}
+
+// Collector returns a prometheus collector of the named redis client pool stats.
+func Collector(name ...string) prometheus.Collector {
+	redisName := Default
+	if len(name) > 0 {
+		redisName = name[0]
+	}
+	return metrics.Redis(redisName, Redis(name...))
+}
@@ -8,10 +8,13 @@ import (
 
 	"go.uber.org/zap"
 
+	"github.com/donech/tool/health"
+	"github.com/donech/tool/metrics"
 	"github.com/donech/tool/xlog"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var CreatedFiledName = "created_time"
@@ -157,3 +160,13 @@ func addExtraSpaceIfExist(str string) string {
 	}
 	return ""
 }
+
+// Checker returns a health.Checker that pings the underlying connection pool.
+func Checker(db *gorm.DB) health.Checker {
+	return health.SQL(db.DB())
+}
+
+// Collector returns a prometheus collector of the connection pool stats labeled with name.
+func Collector(name string, db *gorm.DB) prometheus.Collector {
+	return metrics.SQL(name, db.DB())
+}
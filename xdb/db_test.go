@@ -3,6 +3,9 @@ package xdb
 import (
 	"context"
 	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/donech/tool/xtrace"
@@ -21,6 +24,11 @@ type LotteryRecord struct {
 }
 
 func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
 	logConfig := xlog.Config{
 		ServiceName: "db_test",
 		Level:       "debug",
@@ -28,14 +36,15 @@ func TestOpen(t *testing.T) {
 		Format:      "json",
 		Stdout:      false,
 		File: xlog.FileLogConfig{
-			Filename:  "test.log",
+			Filename:  filepath.Join(dir, "test.log"),
 			LogRotate: false,
 		},
 	}
-	_, err := xlog.New(logConfig)
+	_, closeLog, err := xlog.New(logConfig)
 	if err != nil {
 		t.Error("init logger failed")
 	}
+	defer closeLog()
 
 	dbConfig := Config{
 		Dsn:         "root:example@tcp(localhost:3306)/nirvana?charset=utf8mb4&parseTime=true&loc=Local",
@@ -0,0 +1,72 @@
+package xhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// StatusError is returned by the JSON helpers when the response status is not 2xx.
+type StatusError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected http status %d: %s", e.StatusCode, e.Body)
+}
+
+// New returns a Client whose transport is NewTransport(conf, nil).
+func New(conf Config) *Client {
+	return &Client{Client: &http.Client{Transport: NewTransport(conf, nil)}}
+}
+
+type Client struct {
+	*http.Client
+}
+
+func (c *Client) GetJSON(ctx context.Context, url string, out interface{}) error {
+	return c.DoJSON(ctx, http.MethodGet, url, nil, out)
+}
+
+func (c *Client) PostJSON(ctx context.Context, url string, in, out interface{}) error {
+	return c.DoJSON(ctx, http.MethodPost, url, in, out)
+}
+
+// DoJSON sends in as a JSON body when it is not nil and decodes the response into out when it is not nil.
+func (c *Client) DoJSON(ctx context.Context, method, url string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &StatusError{StatusCode: resp.StatusCode, Body: b}
+	}
+	if out == nil {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
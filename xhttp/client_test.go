@@ -0,0 +1,109 @@
+package xhttp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/donech/tool/xtrace"
+)
+
+func TestClient_PostJSON(t *testing.T) {
+	assert := require.New(t)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		in := map[string]string{}
+		assert.NoError(json.NewDecoder(r.Body).Decode(&in))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"name":     in["name"],
+			"trace_id": xtrace.GetTraceIDFromHTTPHeader(r.Header),
+		})
+	}))
+	defer srv.Close()
+
+	c := New(Config{Retry: RetryConfig{MaxAttempts: 2, InitialBackoff: time.Millisecond}})
+	ctx := NewCtxWithRetry(context.WithValue(context.Background(), xtrace.KeyName, "trace-1"))
+	out := map[string]string{}
+	assert.NoError(c.PostJSON(ctx, srv.URL, map[string]string{"name": "donech"}, &out))
+	assert.Equal(int32(2), calls)
+	assert.Equal(map[string]string{"name": "donech", "trace_id": "trace-1"}, out)
+}
+
+func TestTransport_NoRetryForPost(t *testing.T) {
+	assert := require.New(t)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := New(Config{Retry: RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond}})
+	err := c.PostJSON(context.Background(), srv.URL, map[string]string{"name": "donech"}, nil)
+	assert.Equal(http.StatusServiceUnavailable, err.(*StatusError).StatusCode)
+	assert.Equal(int32(1), atomic.LoadInt32(&calls))
+
+	// an idempotency key makes the post safe to retry
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("{}"))
+	assert.NoError(err)
+	req.Header.Set("Idempotency-Key", "order-1")
+	resp, err := c.Do(req)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestClient_StatusError(t *testing.T) {
+	assert := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEmpty(xtrace.GetTraceIDFromHTTPHeader(r.Header))
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("bad request"))
+	}))
+	defer srv.Close()
+
+	err := New(Config{}).GetJSON(context.Background(), srv.URL, nil)
+	assert.Equal(&StatusError{StatusCode: http.StatusBadRequest, Body: []byte("bad request")}, err)
+}
+
+func TestTransport_HostTimeout(t *testing.T) {
+	assert := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	c := New(Config{Hosts: map[string]HostConfig{u.Host: {Timeout: 20 * time.Millisecond}}})
+	err := c.GetJSON(context.Background(), srv.URL, nil)
+	assert.Error(err)
+	assert.Contains(err.Error(), context.DeadlineExceeded.Error())
+}
+
+func TestTransport_redactHeader(t *testing.T) {
+	assert := require.New(t)
+	tr := NewTransport(Config{}, nil)
+	h := http.Header{}
+	h.Set("Authorization", "Bearer secret")
+	h.Set("Content-Type", "application/json")
+	redactedHeader := tr.redactHeader(h)
+	assert.Equal(redacted, redactedHeader.Get("Authorization"))
+	assert.Equal("application/json", redactedHeader.Get("Content-Type"))
+	assert.Equal("Bearer secret", h.Get("Authorization"))
+}
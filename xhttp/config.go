@@ -0,0 +1,34 @@
+package xhttp
+
+import "time"
+
+type Config struct {
+	// Timeout default timeout of a single attempt, 0 means no timeout.
+	Timeout time.Duration `yaml:"timeout"`
+	// Retry default retry policy.
+	Retry RetryConfig `yaml:"retry"`
+	// Hosts overrides Timeout and Retry by request host, e.g. user-service:8080.
+	Hosts map[string]HostConfig `yaml:"hosts"`
+	// MaxBodyLogSize max bytes of request and response body written to the log, default 1024, -1 disables body logging.
+	MaxBodyLogSize int `yaml:"maxBodyLogSize"`
+	// RedactHeaders header values replaced in the log, default Authorization, Cookie, Set-Cookie and Token.
+	RedactHeaders []string `yaml:"redactHeaders"`
+}
+
+type HostConfig struct {
+	Timeout time.Duration `yaml:"timeout"`
+	Retry   *RetryConfig  `yaml:"retry"`
+}
+
+type RetryConfig struct {
+	// MaxAttempts including the original request, retry is disabled when it is less than 2.
+	// Only GET, HEAD, OPTIONS, PUT and DELETE are retried unless the request has an
+	// Idempotency-Key header or its context comes from NewCtxWithRetry.
+	MaxAttempts int `yaml:"maxAttempts"`
+	// InitialBackoff default 100ms, doubled after every attempt.
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	// MaxBackoff default 1s.
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+	// RetryableStatus response status codes worth a retry, default 502, 503 and 504.
+	RetryableStatus []int `yaml:"retryableStatus"`
+}
@@ -0,0 +1,270 @@
+// Package xhttp provides an outbound http client that propagates the trace
+// id and logs requests the same way middleware.GinZap does.
+package xhttp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/donech/tool/xlog"
+	"github.com/donech/tool/xtrace"
+)
+
+const redacted = "***"
+
+var defaultMaxBodyLogSize = 1024
+
+var defaultRedactHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Token"}
+
+var defaultRetryableStatus = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// idempotentMethods are retried by default, others only with an
+// Idempotency-Key header or a context from NewCtxWithRetry.
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+const headerIdempotencyKey = "Idempotency-Key"
+
+type retryCtxKey struct{}
+
+// NewCtxWithRetry allows the requests sent with ctx to be retried whatever
+// their method, use it when the downstream handles duplicates.
+func NewCtxWithRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryCtxKey{}, true)
+}
+
+// idempotent reports whether req may be sent more than once.
+func idempotent(req *http.Request) bool {
+	if idempotentMethods[req.Method] || req.Header.Get(headerIdempotencyKey) != "" {
+		return true
+	}
+	retry, _ := req.Context().Value(retryCtxKey{}).(bool)
+	return retry
+}
+
+// NewTransport wraps base, http.DefaultTransport when nil.
+func NewTransport(conf Config, base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if conf.MaxBodyLogSize == 0 {
+		conf.MaxBodyLogSize = defaultMaxBodyLogSize
+	}
+	if conf.RedactHeaders == nil {
+		conf.RedactHeaders = defaultRedactHeaders
+	}
+	redact := make(map[string]bool, len(conf.RedactHeaders))
+	for _, h := range conf.RedactHeaders {
+		redact[http.CanonicalHeaderKey(h)] = true
+	}
+	return &Transport{base: base, conf: conf, redact: redact}
+}
+
+// Transport is a http.RoundTripper that injects the X-Request-ID header from
+// the request context, applies per host timeouts and retries, and logs every
+// request through xlog.L(ctx).
+type Transport struct {
+	base   http.RoundTripper
+	conf   Config
+	redact map[string]bool
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := xtrace.NewCtxWithTraceID(req.Context())
+	traceID := xtrace.GetTraceIDFromContext(ctx)
+	req = req.Clone(ctx)
+	if xtrace.GetTraceIDFromHTTPHeader(req.Header) == "" {
+		req.Header.Set(string(xtrace.KeyName), traceID)
+	}
+
+	timeout, retry := t.policy(req.URL.Host)
+	retryable := retry.MaxAttempts > 1 && idempotent(req) &&
+		(req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+	backoff := retry.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		resp, err := t.attempt(ctx, req, traceID, timeout, attempt)
+		if !retryable || attempt >= retry.MaxAttempts || !retry.shouldRetry(resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleep(ctx, backoff); err != nil {
+			return nil, err
+		}
+		if backoff *= 2; backoff > retry.MaxBackoff {
+			backoff = retry.MaxBackoff
+		}
+	}
+}
+
+func (t *Transport) attempt(ctx context.Context, req *http.Request, traceID string, timeout time.Duration, attempt int) (*http.Response, error) {
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	r := req.WithContext(ctx)
+	if attempt > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		r.Body = body
+	}
+
+	start := time.Now()
+	xlog.L(ctx).Info("Request send:",
+		zap.String(string(xtrace.KeyName), traceID),
+		zap.String("host", r.URL.Host),
+		zap.String("path", r.URL.Path),
+		zap.String("method", r.Method),
+		zap.Reflect("header", t.redactHeader(r.Header)),
+		zap.String("query", r.URL.RawQuery),
+		zap.Int("attempt", attempt),
+		zap.String("body", t.requestBody(r)),
+		zap.String("time", start.Format(time.RFC3339)),
+	)
+	resp, err := t.base.RoundTrip(r)
+	latency := time.Since(start)
+	if err != nil {
+		cancel()
+		xlog.L(ctx).Error("Request failed:",
+			zap.String(string(xtrace.KeyName), traceID),
+			zap.String("host", r.URL.Host),
+			zap.String("path", r.URL.Path),
+			zap.String("method", r.Method),
+			zap.Duration("latency", latency),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	xlog.L(ctx).Info("Request response:",
+		zap.String(string(xtrace.KeyName), traceID),
+		zap.String("host", r.URL.Host),
+		zap.String("path", r.URL.Path),
+		zap.String("method", r.Method),
+		zap.Reflect("header", t.redactHeader(resp.Header)),
+		zap.Int("status", resp.StatusCode),
+		zap.Duration("latency", latency),
+		zap.String("body", t.responseBody(resp)),
+	)
+	return resp, nil
+}
+
+func (t *Transport) policy(host string) (time.Duration, RetryConfig) {
+	timeout, retry := t.conf.Timeout, t.conf.Retry
+	if h, ok := t.conf.Hosts[host]; ok {
+		if h.Timeout > 0 {
+			timeout = h.Timeout
+		}
+		if h.Retry != nil {
+			retry = *h.Retry
+		}
+	}
+	if retry.InitialBackoff <= 0 {
+		retry.InitialBackoff = 100 * time.Millisecond
+	}
+	if retry.MaxBackoff <= 0 {
+		retry.MaxBackoff = time.Second
+	}
+	if len(retry.RetryableStatus) == 0 {
+		retry.RetryableStatus = defaultRetryableStatus
+	}
+	return timeout, retry
+}
+
+func (c RetryConfig) shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	for _, code := range c.RetryableStatus {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Transport) redactHeader(header http.Header) http.Header {
+	h := make(http.Header, len(header))
+	for k, v := range header {
+		if t.redact[http.CanonicalHeaderKey(k)] {
+			h[k] = []string{redacted}
+			continue
+		}
+		h[k] = v
+	}
+	return h
+}
+
+func (t *Transport) requestBody(r *http.Request) string {
+	if t.conf.MaxBodyLogSize < 0 || r.GetBody == nil || !loggable(r.Header) {
+		return ""
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+	b, _ := ioutil.ReadAll(io.LimitReader(body, int64(t.conf.MaxBodyLogSize)))
+	return string(b)
+}
+
+// responseBody reads at most MaxBodyLogSize bytes and puts them back in front of resp.Body.
+func (t *Transport) responseBody(resp *http.Response) string {
+	if t.conf.MaxBodyLogSize < 0 || !loggable(resp.Header) {
+		return ""
+	}
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, int64(t.conf.MaxBodyLogSize)))
+	resp.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(b), resp.Body), Closer: resp.Body}
+	return string(b)
+}
+
+func loggable(header http.Header) bool {
+	contentType := header.Get("Content-Type")
+	return strings.Contains(contentType, "json") || strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "x-www-form-urlencoded")
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// cancelBody releases the per attempt timeout once the body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
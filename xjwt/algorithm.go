@@ -0,0 +1,196 @@
+package xjwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	familyHMAC    = "HMAC"
+	familyRSA     = "RSA"
+	familyECDSA   = "ECDSA"
+	familyEd25519 = "Ed25519"
+)
+
+var ErrInvalidKeyPEM = errors.New("no PEM encoded key found")
+
+// SigningMethodEdDSA signs with Ed25519 keys, jwt-go doesn't ship it.
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+type signingMethodEdDSA struct{}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(public, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(private, []byte(signingString))), nil
+}
+
+// algorithmFamily returns the kind of key alg needs, empty for unsupported algorithms.
+func algorithmFamily(alg string) string {
+	switch alg {
+	case "HS256", "HS384", "HS512":
+		return familyHMAC
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		return familyRSA
+	case "ES256", "ES384", "ES512":
+		return familyECDSA
+	case "EdDSA":
+		return familyEd25519
+	}
+	return ""
+}
+
+// keyFamily returns the kind of a public or private key.
+func keyFamily(key interface{}) string {
+	switch key.(type) {
+	case []byte:
+		return familyHMAC
+	case *rsa.PublicKey, *rsa.PrivateKey:
+		return familyRSA
+	case *ecdsa.PublicKey, *ecdsa.PrivateKey:
+		return familyECDSA
+	case ed25519.PublicKey, ed25519.PrivateKey:
+		return familyEd25519
+	}
+	return ""
+}
+
+// curves of the ES algorithms, RFC 7518 section 3.4.
+var curves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+	"ES512": elliptic.P521(),
+}
+
+// checkKey reports whether key, public or private, can be used with alg.
+func checkKey(alg string, key interface{}) error {
+	family := algorithmFamily(alg)
+	if family == "" {
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if got := keyFamily(key); got != family {
+		return fmt.Errorf("signing algorithm %s needs a %s key, got %T", alg, family, key)
+	}
+	var curve elliptic.Curve
+	switch k := key.(type) {
+	case []byte:
+		if len(k) == 0 {
+			return fmt.Errorf("signing algorithm %s needs a non empty key", alg)
+		}
+	case *ecdsa.PublicKey:
+		curve = k.Curve
+	case *ecdsa.PrivateKey:
+		curve = k.Curve
+	}
+	if curve != nil && curve != curves[alg] {
+		return fmt.Errorf("signing algorithm %s needs curve %s, got %s", alg, curves[alg].Params().Name, curve.Params().Name)
+	}
+	return nil
+}
+
+// ParsePrivateKeyPEM parses a PKCS #8, PKCS #1 or SEC 1 private key.
+func ParsePrivateKeyPEM(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKeyPEM
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported private key in PEM block %q", block.Type)
+}
+
+// ParsePublicKeyPEM parses a PKIX or PKCS #1 public key, or the key of a certificate.
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKeyPEM
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+		return cert.PublicKey, nil
+	}
+	return nil, fmt.Errorf("unsupported public key in PEM block %q", block.Type)
+}
+
+// publicOf returns the public half of a private key.
+func publicOf(private crypto.PrivateKey) crypto.PublicKey {
+	if signer, ok := private.(crypto.Signer); ok {
+		return signer.Public()
+	}
+	return nil
+}
+
+// ECDSAKeyGenerator generates keys on the curve of alg, one of ES256, ES384 or ES512.
+func ECDSAKeyGenerator(alg string) KeyGenerator {
+	return func() (Key, error) {
+		curve, ok := curves[alg]
+		if !ok {
+			return Key{}, fmt.Errorf("unsupported signing algorithm %q", alg)
+		}
+		private, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return Key{}, err
+		}
+		return newKey("", alg, private, &private.PublicKey)
+	}
+}
+
+// Ed25519KeyGenerator generates EdDSA keys.
+func Ed25519KeyGenerator() KeyGenerator {
+	return func() (Key, error) {
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return Key{}, err
+		}
+		return newKey("", "EdDSA", private, public)
+	}
+}
@@ -0,0 +1,119 @@
+package xjwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKeyPair(t *testing.T, dir, name string, private crypto.PrivateKey) (string, string) {
+	privateDer, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	publicDer, err := x509.MarshalPKIXPublicKey(publicOf(private))
+	require.NoError(t, err)
+	privateFile := filepath.Join(dir, name+".pem")
+	publicFile := filepath.Join(dir, name+".pub.pem")
+	require.NoError(t, ioutil.WriteFile(privateFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDer}), 0600))
+	require.NoError(t, ioutil.WriteFile(publicFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer}), 0600))
+	return privateFile, publicFile
+}
+
+func TestJWTFactory_Algorithms(t *testing.T) {
+	assert := require.New(t)
+	dir, err := ioutil.TempDir("", "xjwt")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	keys := map[string]crypto.PrivateKey{
+		"RS256": rsaKey,
+		"PS256": rsaKey,
+		"PS512": rsaKey,
+		"EdDSA": edKey,
+	}
+	for alg, curve := range curves {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		assert.NoError(err)
+		keys[alg] = key
+	}
+
+	for alg, private := range keys {
+		privateFile, publicFile := writeKeyPair(t, dir, alg, private)
+		issuer, err := NewJWTFactory(Config{SingingAlgorithm: alg, PrivateKeyFile: privateFile}, WithLoginFunc(login))
+		assert.NoError(err, alg)
+		token, err := issuer.GenerateTokenWithClaims(jwt.MapClaims{"id": 1})
+		assert.NoError(err, alg)
+
+		verifier, err := NewJWTFactory(Config{SingingAlgorithm: alg, PublicKeyFile: publicFile})
+		assert.NoError(err, alg)
+		assert.True(verifier.VerifyToken(token), alg)
+
+		raw, err := NewJWTFactory(Config{SingingAlgorithm: alg}, WithPublicKey(publicOf(private)))
+		assert.NoError(err, alg)
+		assert.True(raw.VerifyToken(token), alg)
+
+		jwks := issuer.JWKS()
+		assert.Len(jwks.Keys, 1, alg)
+		public, err := jwks.Keys[0].PublicKey()
+		assert.NoError(err, alg)
+		remote, err := NewJWTFactory(Config{SingingAlgorithm: alg}, WithPublicKey(public))
+		assert.NoError(err, alg)
+		assert.True(remote.VerifyToken(token), alg)
+	}
+}
+
+func TestJWTFactory_KeyMismatch(t *testing.T) {
+	assert := require.New(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(err)
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(err)
+
+	for name, c := range map[string]struct {
+		conf Config
+		opts []Option
+	}{
+		"ES256 with RSA":    {Config{SingingAlgorithm: "ES256"}, []Option{WithPrivateKey(rsaKey)}},
+		"ES256 with P-384":  {Config{SingingAlgorithm: "ES256"}, []Option{WithPrivateKey(p384)}},
+		"EdDSA with RSA":    {Config{SingingAlgorithm: "EdDSA", PublicKeyFile: "./testData/zq_mall_rsa_public_key.pem"}, nil},
+		"HS256 without key": {Config{SingingAlgorithm: "HS256"}, nil},
+		"unknown":           {Config{SingingAlgorithm: "XX256", Key: "secret"}, nil},
+		"RS256 without key": {Config{SingingAlgorithm: "RS256"}, nil},
+	} {
+		_, err := NewJWTFactory(c.conf, append(c.opts, WithLoginFunc(login))...)
+		assert.Error(err, name)
+	}
+}
+
+func TestParseKeyPEM(t *testing.T) {
+	assert := require.New(t)
+	data, err := ioutil.ReadFile("./testData/zq_mall_rsa_private_key.pem")
+	assert.NoError(err)
+	private, err := ParsePrivateKeyPEM(data)
+	assert.NoError(err)
+	assert.IsType(&rsa.PrivateKey{}, private)
+
+	data, err = ioutil.ReadFile("./testData/zq_mall_rsa_public_key.pem")
+	assert.NoError(err)
+	public, err := ParsePublicKeyPEM(data)
+	assert.NoError(err)
+	assert.IsType(&rsa.PublicKey{}, public)
+
+	_, err = ParsePublicKeyPEM([]byte("not pem"))
+	assert.Equal(ErrInvalidKeyPEM, err)
+}
@@ -0,0 +1,135 @@
+package xjwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrInvalidClaims  = errors.New("jwt claims don't fit the claims type")
+	ErrNoClaims       = errors.New("no jwt claims in context")
+	ErrNotPointerDest = errors.New("jwt claims destination must be a non nil pointer")
+)
+
+// TypedLoginFunc is a LoginFunc returning a claims struct, see TypedLogin.
+type TypedLoginFunc func(ctx context.Context, form LoginForm) (interface{}, error)
+
+// TypedLogin adapts f to a LoginFunc, the struct returned by f is converted
+// through its json tags.
+func TypedLogin(f TypedLoginFunc) LoginFunc {
+	return func(ctx context.Context, form LoginForm) (jwt.MapClaims, error) {
+		v, err := f(ctx, form)
+		if err != nil {
+			return nil, err
+		}
+		return ToMapClaims(v)
+	}
+}
+
+// WithClaimsType decodes verified claims into the value returned by
+// newClaims, e.g. func() interface{} { return &UserClaims{} }. The gin
+// middleware and the grpc interceptor put it into the context next to the
+// MapClaims, read it back with ClaimsFromCtx or GetTypedClaimsFromCtx.
+func WithClaimsType(newClaims func() interface{}) Option {
+	return func(factory *JWTFactory) {
+		factory.newClaims = newClaims
+	}
+}
+
+// ToMapClaims converts a claims struct to MapClaims through its json tags.
+func ToMapClaims(v interface{}) (jwt.MapClaims, error) {
+	if claims, ok := v.(jwt.MapClaims); ok {
+		return claims, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	claims := jwt.MapClaims{}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// DecodeClaims fills the struct dst points to from claims through its json tags.
+func DecodeClaims(claims jwt.MapClaims, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return ErrNotPointerDest
+	}
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidClaims, err)
+	}
+	return nil
+}
+
+// GenerateTypedToken is GenerateTokenWithClaims for a claims struct.
+func (f JWTFactory) GenerateTypedToken(v interface{}) (string, error) {
+	claims, err := ToMapClaims(v)
+	if err != nil {
+		return "", err
+	}
+	return f.GenerateTokenWithClaims(claims)
+}
+
+// GetTypedClaims verifies token like GetClaimsContext and decodes its claims into dst.
+func (f JWTFactory) GetTypedClaims(ctx context.Context, token string, dst interface{}) error {
+	claims, err := f.GetClaimsContext(ctx, token)
+	if err != nil {
+		return err
+	}
+	return DecodeClaims(claims, dst)
+}
+
+// NewContext puts claims into ctx, decoded into the WithClaimsType value as well when one is set.
+func (f JWTFactory) NewContext(ctx context.Context, claims jwt.MapClaims) (context.Context, error) {
+	ctx = SetClaimsToCtx(ctx, claims)
+	if f.newClaims == nil {
+		return ctx, nil
+	}
+	v := f.newClaims()
+	if err := DecodeClaims(claims, v); err != nil {
+		return ctx, err
+	}
+	return SetTypedClaimsToCtx(ctx, v), nil
+}
+
+func SetTypedClaimsToCtx(ctx context.Context, v interface{}) context.Context {
+	return context.WithValue(ctx, CtxTypedClaimKey, v)
+}
+
+// GetTypedClaimsFromCtx returns the value put by SetTypedClaimsToCtx, nil when there is none.
+func GetTypedClaimsFromCtx(ctx context.Context) interface{} {
+	return ctx.Value(CtxTypedClaimKey)
+}
+
+// ClaimsFromCtx fills dst from the claims of ctx. The typed value is copied
+// when dst points to the same type, the MapClaims are decoded otherwise.
+func ClaimsFromCtx(ctx context.Context, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return ErrNotPointerDest
+	}
+	if v := GetTypedClaimsFromCtx(ctx); v != nil {
+		tv := reflect.ValueOf(v)
+		if tv.Type() == rv.Type() {
+			rv.Elem().Set(tv.Elem())
+			return nil
+		}
+	}
+	claims, ok := ctx.Value(CtxJWTKey).(jwt.MapClaims)
+	if !ok {
+		return ErrNoClaims
+	}
+	return DecodeClaims(claims, dst)
+}
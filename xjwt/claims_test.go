@@ -0,0 +1,60 @@
+package xjwt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+)
+
+type userClaims struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+func TestTypedClaims(t *testing.T) {
+	assert := require.New(t)
+	f, err := NewJWTFactory(Config{SingingAlgorithm: "HS256", Key: "secret"},
+		WithLoginFunc(TypedLogin(func(ctx context.Context, form LoginForm) (interface{}, error) {
+			return userClaims{ID: 7, Username: form.Username}, nil
+		})),
+		WithClaimsType(func() interface{} { return &userClaims{} }),
+	)
+	assert.NoError(err)
+
+	token, err := f.GenerateToken(context.Background(), LoginForm{Username: "u", Password: "p"})
+	assert.NoError(err)
+	claims := userClaims{}
+	assert.NoError(f.GetTypedClaims(context.Background(), token, &claims))
+	assert.Equal(userClaims{ID: 7, Username: "u"}, claims)
+
+	token, err = f.GenerateTypedToken(userClaims{ID: 8, Username: "s"})
+	assert.NoError(err)
+	mapClaims, err := f.GetClaims(token)
+	assert.NoError(err)
+	ctx, err := f.NewContext(context.Background(), mapClaims)
+	assert.NoError(err)
+	assert.Equal(&userClaims{ID: 8, Username: "s"}, GetTypedClaimsFromCtx(ctx))
+	assert.NoError(ClaimsFromCtx(ctx, &claims))
+	assert.Equal(int64(8), claims.ID)
+	assert.Equal(ErrNotPointerDest, ClaimsFromCtx(ctx, claims))
+
+	// without a claims type the map is decoded
+	ctx = SetClaimsToCtx(context.Background(), jwt.MapClaims{"id": float64(9)})
+	assert.NoError(ClaimsFromCtx(ctx, &claims))
+	assert.Equal(int64(9), claims.ID)
+	assert.Equal(ErrNoClaims, ClaimsFromCtx(context.Background(), &claims))
+
+	// a claim of the wrong type is an error rather than a panic
+	_, err = f.NewContext(context.Background(), jwt.MapClaims{"id": "seven"})
+	assert.ErrorIs(err, ErrInvalidClaims)
+	assert.Equal("invalid_claims", ErrorReason(err))
+}
+
+func TestGetClaimsFromCtx(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.WithValue(context.Background(), CtxJWTKey, "not claims")
+	assert.Equal(jwt.MapClaims{}, GetClaimsFromCtx(ctx))
+	assert.Equal(jwt.MapClaims{}, GetClaimsFromCtx(context.Background()))
+}
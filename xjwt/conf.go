@@ -6,4 +6,23 @@ type Config struct {
 	PublicKeyFile    string `yaml:"publicKeyFile"`
 	PrivateKeyFile   string `yaml:"privateKeyFile"`
 	Timeout          string `yaml:"timeout"`
+	// RefreshTimeout how long refresh tokens stay valid, default 168h.
+	RefreshTimeout string `yaml:"refreshTimeout"`
+	// Issuer iss of issued tokens, verified tokens must carry it when set.
+	Issuer string `yaml:"issuer"`
+	// Audience aud of issued tokens, verified tokens must name one of them when set.
+	Audience []string `yaml:"audience"`
+	// Leeway tolerated clock skew when checking exp, nbf and iat, e.g. 30s.
+	Leeway string `yaml:"leeway"`
+	// KeyID kid of the configured key, default the RFC 7638 thumbprint for asymmetric keys.
+	KeyID string `yaml:"keyId"`
+	// RotationInterval generates a new signing key at this interval, e.g. 24h, disabled when empty.
+	// Every instance generates its own keys, so it only suits a single issuer.
+	RotationInterval string `yaml:"rotationInterval"`
+	// JWKSURL verifies tokens against a remote JWKS instead of local keys, the factory can't sign then.
+	JWKSURL string `yaml:"jwksUrl"`
+	// JWKSCacheTTL how long the remote JWKS is cached, default 10m.
+	JWKSCacheTTL string `yaml:"jwksCacheTtl"`
+	// Revocation where revoked tokens are remembered, see JWTFactory.Revoke.
+	Revocation RevocationConfig `yaml:"revocation"`
 }
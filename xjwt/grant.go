@@ -0,0 +1,166 @@
+package xjwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Grant types selected by the grant_type of a GrantRequest.
+const (
+	GrantPassword          = "password"
+	GrantSMS               = "sms"
+	GrantAPIKey            = "api_key"
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+)
+
+var (
+	ErrUnsupportedGrantType = errors.New("jwt grant type is not supported")
+	ErrInvalidGrant         = errors.New("jwt grant credentials are missing")
+)
+
+// GrantRequest carries the credentials of every grant type, each
+// Authenticator reads the fields of its own grant type.
+type GrantRequest struct {
+	// GrantType defaults to password.
+	GrantType    string `json:"grant_type" form:"grant_type"`
+	Username     string `json:"username" form:"username"`
+	Password     string `json:"password" form:"password"`
+	Phone        string `json:"phone" form:"phone"`
+	Code         string `json:"code" form:"code"`
+	APIKey       string `json:"api_key" form:"api_key"`
+	ClientID     string `json:"client_id" form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+	Scope        string `json:"scope" form:"scope"`
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+}
+
+// Authenticator verifies the credentials of a grant type and returns the
+// claims of the token to issue.
+type Authenticator interface {
+	Authenticate(ctx context.Context, req GrantRequest) (jwt.MapClaims, error)
+}
+
+type AuthenticatorFunc func(ctx context.Context, req GrantRequest) (jwt.MapClaims, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, req GrantRequest) (jwt.MapClaims, error) {
+	return f(ctx, req)
+}
+
+// PasswordAuthenticator authenticates username and password through login.
+func PasswordAuthenticator(login LoginFunc) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, req GrantRequest) (jwt.MapClaims, error) {
+		if req.Username == "" || req.Password == "" {
+			return nil, fmt.Errorf("%w: username and password are required", ErrInvalidGrant)
+		}
+		return login(ctx, LoginForm{Username: req.Username, Password: req.Password})
+	})
+}
+
+// SMSAuthenticator authenticates a phone number with the code sent to it.
+func SMSAuthenticator(verify func(ctx context.Context, phone, code string) (jwt.MapClaims, error)) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, req GrantRequest) (jwt.MapClaims, error) {
+		if req.Phone == "" || req.Code == "" {
+			return nil, fmt.Errorf("%w: phone and code are required", ErrInvalidGrant)
+		}
+		return verify(ctx, req.Phone, req.Code)
+	})
+}
+
+// APIKeyAuthenticator exchanges an api key for a token.
+func APIKeyAuthenticator(lookup func(ctx context.Context, key string) (jwt.MapClaims, error)) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, req GrantRequest) (jwt.MapClaims, error) {
+		if req.APIKey == "" {
+			return nil, fmt.Errorf("%w: api_key is required", ErrInvalidGrant)
+		}
+		return lookup(ctx, req.APIKey)
+	})
+}
+
+// ClientCredentialsAuthenticator authenticates an OAuth2 client by id and secret,
+// scope is the space separated scope requested.
+func ClientCredentialsAuthenticator(verify func(ctx context.Context, clientID, clientSecret, scope string) (jwt.MapClaims, error)) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, req GrantRequest) (jwt.MapClaims, error) {
+		if req.ClientID == "" || req.ClientSecret == "" {
+			return nil, fmt.Errorf("%w: client_id and client_secret are required", ErrInvalidGrant)
+		}
+		return verify(ctx, req.ClientID, req.ClientSecret, req.Scope)
+	})
+}
+
+// WithAuthenticator registers the Authenticator of grantType, WithLoginFunc
+// registers the password grant unless it is registered here.
+func WithAuthenticator(grantType string, authenticator Authenticator) Option {
+	return func(factory *JWTFactory) {
+		if factory.authenticators == nil {
+			factory.authenticators = map[string]Authenticator{}
+		}
+		factory.authenticators[grantType] = authenticator
+	}
+}
+
+// Authenticate verifies req with the Authenticator of its grant type.
+func (f JWTFactory) Authenticate(ctx context.Context, req GrantRequest) (jwt.MapClaims, error) {
+	grantType := req.GrantType
+	if grantType == "" {
+		grantType = GrantPassword
+	}
+	authenticator, ok := f.authenticators[grantType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedGrantType, grantType)
+	}
+	return authenticator.Authenticate(ctx, req)
+}
+
+// GenerateTokenForGrant issues a token for req. The refresh_token grant spends
+// the refresh token of a pair like GenerateTokenPairForGrant and returns only
+// the new access token, the rotated refresh token is dropped.
+func (f JWTFactory) GenerateTokenForGrant(ctx context.Context, req GrantRequest) (string, error) {
+	if f.VerifyOnly() {
+		return "", ErrVerifyOnly
+	}
+	if req.GrantType == GrantRefreshToken {
+		pair, err := f.refreshGrant(ctx, req)
+		if err != nil {
+			return "", err
+		}
+		return pair.AccessToken, nil
+	}
+	claims, err := f.Authenticate(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return f.GenerateTokenWithClaims(claims)
+}
+
+// GenerateTokenPairForGrant issues a TokenPair for req, the refresh_token
+// grant spends the refresh token of a pair, see Refresh.
+func (f JWTFactory) GenerateTokenPairForGrant(ctx context.Context, req GrantRequest) (TokenPair, error) {
+	if f.VerifyOnly() {
+		return TokenPair{}, ErrVerifyOnly
+	}
+	if req.GrantType == GrantRefreshToken {
+		return f.refreshGrant(ctx, req)
+	}
+	claims, err := f.Authenticate(ctx, req)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return f.GenerateTokenPairWithClaims(claims)
+}
+
+// refreshGrant spends the refresh token of req, see Refresh. Anything but a
+// refresh token, an access token included, is an invalid grant.
+func (f JWTFactory) refreshGrant(ctx context.Context, req GrantRequest) (TokenPair, error) {
+	if req.RefreshToken == "" {
+		return TokenPair{}, fmt.Errorf("%w: refresh_token is required", ErrInvalidGrant)
+	}
+	pair, err := f.Refresh(ctx, req.RefreshToken)
+	if errors.Is(err, ErrNotRefreshToken) {
+		return TokenPair{}, fmt.Errorf("%w: %s", ErrInvalidGrant, err)
+	}
+	return pair, err
+}
@@ -0,0 +1,76 @@
+package xjwt
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTFactory_Grants(t *testing.T) {
+	assert := require.New(t)
+	f, err := NewJWTFactory(Config{SingingAlgorithm: "HS256", Key: "secret", Timeout: "10m"},
+		WithRevocationStore(NewMemoryRevocationStore()),
+		WithAuthenticator(GrantSMS, SMSAuthenticator(func(ctx context.Context, phone, code string) (jwt.MapClaims, error) {
+			if code != "1234" {
+				return nil, errors.New("wrong code")
+			}
+			return jwt.MapClaims{"phone": phone}, nil
+		})),
+		WithAuthenticator(GrantClientCredentials, ClientCredentialsAuthenticator(func(ctx context.Context, id, secret, scope string) (jwt.MapClaims, error) {
+			return jwt.MapClaims{"sub": id, "scope": scope}, nil
+		})),
+	)
+	assert.NoError(err)
+	ctx := context.Background()
+
+	token, err := f.GenerateTokenForGrant(ctx, GrantRequest{GrantType: GrantSMS, Phone: "13800000000", Code: "1234"})
+	assert.NoError(err)
+	claims, err := f.GetClaims(token)
+	assert.NoError(err)
+	assert.Equal("13800000000", claims["phone"])
+	_, err = f.GenerateTokenForGrant(ctx, GrantRequest{GrantType: GrantSMS, Phone: "13800000000", Code: "0000"})
+	assert.EqualError(err, "wrong code")
+	_, err = f.GenerateTokenForGrant(ctx, GrantRequest{GrantType: GrantSMS, Phone: "13800000000"})
+	assert.True(errors.Is(err, ErrInvalidGrant))
+
+	pair, err := f.GenerateTokenPairForGrant(ctx, GrantRequest{GrantType: GrantClientCredentials, ClientID: "svc", ClientSecret: "s", Scope: "read"})
+	assert.NoError(err)
+	refreshed, err := f.GenerateTokenPairForGrant(ctx, GrantRequest{GrantType: GrantRefreshToken, RefreshToken: pair.RefreshToken})
+	assert.NoError(err)
+	claims, err = f.GetClaims(refreshed.AccessToken)
+	assert.NoError(err)
+	assert.Equal("svc", claims["sub"])
+
+	token, err = f.GenerateTokenForGrant(ctx, GrantRequest{GrantType: GrantRefreshToken, RefreshToken: refreshed.RefreshToken})
+	assert.NoError(err)
+	claims, err = f.GetClaims(token)
+	assert.NoError(err)
+	assert.Equal("svc", claims["sub"])
+	_, err = f.GenerateTokenForGrant(ctx, GrantRequest{GrantType: GrantRefreshToken, RefreshToken: refreshed.RefreshToken})
+	assert.Equal(ErrRefreshTokenReused, err)
+	for _, access := range []string{token, pair.AccessToken} {
+		_, err = f.GenerateTokenForGrant(ctx, GrantRequest{GrantType: GrantRefreshToken, RefreshToken: access})
+		assert.True(errors.Is(err, ErrInvalidGrant), err)
+		_, err = f.GenerateTokenPairForGrant(ctx, GrantRequest{GrantType: GrantRefreshToken, RefreshToken: access})
+		assert.True(errors.Is(err, ErrInvalidGrant), err)
+	}
+
+	// no LoginFunc, so the password grant is not registered
+	_, err = f.GenerateToken(ctx, LoginForm{Username: "1111", Password: "2222"})
+	assert.True(errors.Is(err, ErrUnsupportedGrantType))
+	_, err = f.GenerateTokenForGrant(ctx, GrantRequest{GrantType: GrantAPIKey, APIKey: "key"})
+	assert.True(errors.Is(err, ErrUnsupportedGrantType))
+}
+
+func TestJWTFactory_PasswordGrant(t *testing.T) {
+	assert := require.New(t)
+	f, err := NewJWTFactory(Config{SingingAlgorithm: "HS256", Key: "secret", Timeout: "10m"}, WithLoginFunc(login))
+	assert.NoError(err)
+	_, err = f.GenerateTokenForGrant(context.Background(), GrantRequest{Username: "1111", Password: "2222"})
+	assert.NoError(err)
+	_, err = f.GenerateToken(context.Background(), LoginForm{Username: "1111"})
+	assert.True(errors.Is(err, ErrInvalidGrant))
+}
@@ -0,0 +1,279 @@
+package xjwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const JWKSPath = "/.well-known/jwks.json"
+
+var ErrUnsupportedKey = errors.New("unsupported jwk key type")
+
+var (
+	defaultJWKSCacheTTL = 10 * time.Minute
+	// minJWKSRefetch limits refetching when tokens carry an unknown kid.
+	minJWKSRefetch = 10 * time.Second
+)
+
+// JSONWebKey is the public part of a key as defined by RFC 7517.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// NewJSONWebKey encodes an RSA, ECDSA or Ed25519 public key.
+func NewJSONWebKey(kid, alg string, public interface{}) (JSONWebKey, error) {
+	jwk := JSONWebKey{Kid: kid, Use: "sig", Alg: alg}
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeSegment(key.N.Bytes())
+		jwk.E = encodeSegment(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = key.Curve.Params().Name
+		jwk.X = encodeSegment(padBytes(key.X.Bytes(), size))
+		jwk.Y = encodeSegment(padBytes(key.Y.Bytes(), size))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encodeSegment(key)
+	default:
+		return JSONWebKey{}, ErrUnsupportedKey
+	}
+	return jwk, nil
+}
+
+// PublicKey decodes the key into *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey.
+func (k JSONWebKey) PublicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeSegment(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeSegment(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported jwk curve %q", k.Crv)
+		}
+		x, err := decodeSegment(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeSegment(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported jwk curve %q", k.Crv)
+		}
+		x, err := decodeSegment(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedKey
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of the key.
+func (k JSONWebKey) Thumbprint() (string, error) {
+	var members string
+	switch k.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k.E, k.N)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, k.Crv, k.X, k.Y)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, k.Crv, k.X)
+	default:
+		return "", ErrUnsupportedKey
+	}
+	sum := sha256.Sum256([]byte(members))
+	return encodeSegment(sum[:]), nil
+}
+
+// padBytes left pads b with zeros to size, as EC coordinates are fixed length.
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// JWKSHandler serves the public keys of keys, meant for JWKSPath.
+func JWKSHandler(keys *KeySet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		_ = json.NewEncoder(w).Encode(keys.JWKS())
+	})
+}
+
+// NewRemoteKeySet returns a KeyProvider backed by the JWKS at url, cached for
+// ttl. A kid missing from the cache triggers a refetch, at most every 10s.
+// Concurrent lookups share one fetch, and after a failed fetch the stale keys
+// are served without retrying for 10s.
+func NewRemoteKeySet(url string, ttl time.Duration, client *http.Client) *RemoteKeySet {
+	if ttl <= 0 {
+		ttl = defaultJWKSCacheTTL
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &RemoteKeySet{url: url, ttl: ttl, client: client}
+}
+
+type RemoteKeySet struct {
+	url     string
+	ttl     time.Duration
+	client  *http.Client
+	mu      sync.Mutex
+	keys    map[string]Key
+	fetched time.Time
+	// inflight is closed when the running fetch is done.
+	inflight chan struct{}
+	failed   time.Time
+	err      error
+}
+
+func (r *RemoteKeySet) Lookup(kid string) (Key, error) {
+	keys, age := r.cached()
+	if keys == nil || age > r.ttl {
+		err := r.refresh()
+		if keys, age = r.cached(); keys == nil {
+			return Key{}, err
+		}
+	}
+	key, ok := keys[kid]
+	if !ok && age > minJWKSRefetch {
+		if err := r.refresh(); err != nil {
+			return Key{}, err
+		}
+		keys, _ = r.cached()
+		key, ok = keys[kid]
+	}
+	if !ok {
+		return Key{}, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// cached returns the keys and the time since they were fetched.
+func (r *RemoteKeySet) cached() (map[string]Key, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.keys, time.Since(r.fetched)
+}
+
+// refresh fetches the keys without holding the lock, callers arriving during a
+// fetch wait for its result instead of starting their own.
+func (r *RemoteKeySet) refresh() error {
+	r.mu.Lock()
+	if wait := r.inflight; wait != nil {
+		r.mu.Unlock()
+		<-wait
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.err
+	}
+	if r.err != nil && time.Since(r.failed) < minJWKSRefetch {
+		defer r.mu.Unlock()
+		return r.err
+	}
+	wait := make(chan struct{})
+	r.inflight = wait
+	r.mu.Unlock()
+
+	keys, err := r.fetch()
+
+	r.mu.Lock()
+	r.inflight, r.err = nil, err
+	if err != nil {
+		r.failed = time.Now()
+	} else {
+		r.keys, r.fetched = keys, time.Now()
+	}
+	r.mu.Unlock()
+	close(wait)
+	return err
+}
+
+// fetch downloads the keys, keys it can't decode are skipped.
+func (r *RemoteKeySet) fetch() (map[string]Key, error) {
+	resp, err := r.client.Get(r.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch jwks %s: unexpected status %d", r.url, resp.StatusCode)
+	}
+	set := JSONWebKeySet{}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]Key, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		public, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = Key{ID: jwk.Kid, Algorithm: jwk.Alg, Public: public}
+	}
+	return keys, nil
+}
@@ -0,0 +1,198 @@
+package xjwt
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTFactory_Rotate(t *testing.T) {
+	assert := require.New(t)
+	f, err := NewJWTFactory(Config{
+		SingingAlgorithm: "RS256",
+		PrivateKeyFile:   "./testData/zq_mall_rsa_private_key.pem",
+		Timeout:          "10m",
+	}, WithLoginFunc(login))
+	assert.NoError(err)
+	first, ok := f.KeySet().Active()
+	assert.True(ok)
+	assert.NotEmpty(first.ID)
+
+	old, err := f.GenerateTokenWithClaims(jwt.MapClaims{"id": 1})
+	assert.NoError(err)
+	next, err := RSAKeyGenerator("RS256", 1024)()
+	assert.NoError(err)
+	f.Rotate(next)
+
+	token, err := f.GenerateTokenWithClaims(jwt.MapClaims{"id": 2})
+	assert.NoError(err)
+	parsed, err := f.parseToken(token)
+	assert.NoError(err)
+	assert.Equal(next.ID, parsed.Header["kid"])
+	assert.True(f.VerifyToken(old))
+
+	jwks := f.JWKS()
+	assert.Len(jwks.Keys, 2)
+	assert.Equal(first.ID, jwks.Keys[0].Kid)
+	assert.Equal("RSA", jwks.Keys[1].Kty)
+
+	f.KeySet().Remove(first.ID)
+	assert.False(f.VerifyToken(old))
+}
+
+func TestJWTFactory_ScheduledRotation(t *testing.T) {
+	assert := require.New(t)
+	f, err := NewJWTFactory(Config{
+		SingingAlgorithm: "HS256",
+		Key:              "secret",
+		RotationInterval: "20ms",
+	}, WithLoginFunc(login))
+	assert.NoError(err)
+	defer f.Close()
+
+	assert.Eventually(func() bool {
+		key, _ := f.KeySet().Active()
+		return key.ID != ""
+	}, time.Second, 10*time.Millisecond)
+	assert.Empty(f.JWKS().Keys)
+	token, err := f.GenerateTokenWithClaims(jwt.MapClaims{"id": 1})
+	assert.NoError(err)
+	assert.True(f.VerifyToken(token))
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	assert := require.New(t)
+	issuer, err := NewJWTFactory(Config{
+		SingingAlgorithm: "RS256",
+		PrivateKeyFile:   "./testData/zq_mall_rsa_private_key.pem",
+	}, WithLoginFunc(login))
+	assert.NoError(err)
+
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		JWKSHandler(issuer.KeySet()).ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	verifier, err := NewJWTFactory(Config{SingingAlgorithm: "RS256", JWKSURL: srv.URL})
+	assert.NoError(err)
+	assert.True(verifier.VerifyOnly())
+	_, err = verifier.GenerateToken(context.Background(), LoginForm{})
+	assert.Error(err)
+
+	token, err := issuer.GenerateTokenWithClaims(jwt.MapClaims{"id": 1})
+	assert.NoError(err)
+	claims, err := verifier.GetClaims(token)
+	assert.NoError(err)
+	assert.Equal(float64(1), claims["id"])
+	assert.True(verifier.VerifyToken(token))
+	assert.Equal(int32(1), atomic.LoadInt32(&fetches))
+
+	// an unknown kid is not refetched within the refetch interval
+	hs, err := NewJWTFactory(Config{SingingAlgorithm: "HS256", Key: "secret", KeyID: "unknown"}, WithLoginFunc(login))
+	assert.NoError(err)
+	forged, err := hs.GenerateTokenWithClaims(jwt.MapClaims{"id": 1})
+	assert.NoError(err)
+	assert.False(verifier.VerifyToken(forged))
+	assert.Equal(int32(1), atomic.LoadInt32(&fetches))
+}
+
+func TestRemoteKeySet_Refresh(t *testing.T) {
+	assert := require.New(t)
+	issuer, err := NewJWTFactory(Config{
+		SingingAlgorithm: "RS256",
+		PrivateKeyFile:   "./testData/zq_mall_rsa_private_key.pem",
+	}, WithLoginFunc(login))
+	assert.NoError(err)
+	active, _ := issuer.KeySet().Active()
+
+	var fetches int32
+	var failing int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		JWKSHandler(issuer.KeySet()).ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	keys := NewRemoteKeySet(srv.URL, 20*time.Millisecond, nil)
+
+	// concurrent lookups share one fetch, a first unknown kid does not fetch twice
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = keys.Lookup(active.ID)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	_, err = keys.Lookup("unknown")
+	assert.Equal(ErrKeyNotFound, err)
+	assert.Equal(int32(1), atomic.LoadInt32(&fetches))
+
+	// a failed refresh serves the stale keys and is not retried right away
+	atomic.StoreInt32(&failing, 1)
+	time.Sleep(30 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		key, err := keys.Lookup(active.ID)
+		assert.NoError(err)
+		assert.Equal(active.ID, key.ID)
+	}
+	_, err = keys.Lookup("unknown")
+	assert.Error(err)
+	assert.Equal(int32(2), atomic.LoadInt32(&fetches))
+}
+
+func TestKeyFunc_AlgorithmMismatch(t *testing.T) {
+	assert := require.New(t)
+	public, err := NewJWTFactory(Config{
+		SingingAlgorithm: "RS256",
+		PublicKeyFile:    "./testData/zq_mall_rsa_public_key.pem",
+	})
+	assert.NoError(err)
+	assert.True(public.VerifyOnly())
+
+	// an HS256 token keyed with the public PEM must not verify
+	pem, err := ioutil.ReadFile("./testData/zq_mall_rsa_public_key.pem")
+	assert.NoError(err)
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"id": 1}).SignedString(pem)
+	assert.NoError(err)
+	_, err = public.GetClaims(signed)
+	assert.Error(err)
+}
+
+func TestJSONWebKey(t *testing.T) {
+	assert := require.New(t)
+	// RFC 7638 section 3.1
+	jwk := JSONWebKey{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+	thumbprint, err := jwk.Thumbprint()
+	assert.NoError(err)
+	assert.Equal("NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", thumbprint)
+
+	public, err := jwk.PublicKey()
+	assert.NoError(err)
+	encoded, err := NewJSONWebKey("", "", public)
+	assert.NoError(err)
+	assert.Equal(jwk.N, encoded.N)
+	assert.Equal(jwk.E, encoded.E)
+}
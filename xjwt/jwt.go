@@ -2,19 +2,32 @@ package xjwt
 
 import (
 	"context"
-	"crypto/rsa"
+	"crypto"
+	"crypto/rand"
 	"errors"
+	"fmt"
 	"io/ioutil"
-	"log"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+
+	"github.com/donech/tool/xlog"
 )
 
 var ErrNoPrivateKeyFile = errors.New("no private key err")
+var ErrVerifyOnly = errors.New("jwt factory has no signing key")
+var (
+	ErrTokenRevoked       = errors.New("jwt token is revoked")
+	ErrNoTokenID          = errors.New("jwt token has no jti")
+	ErrRevocationDisabled = errors.New("jwt revocation store is not configured")
+	ErrNotAccessToken     = errors.New("jwt token is not an access token")
+)
 
 const (
-	CtxJWTKey KeyType = "jwt"
+	CtxJWTKey        KeyType = "jwt"
+	CtxTypedClaimKey KeyType = "jwt-typed"
 )
 
 type KeyType string
@@ -24,6 +37,11 @@ type LoginForm struct {
 	Password string `json:"password" form:"password" binding:"required"`
 }
 
+// RefreshForm carries the refresh token of a TokenPair.
+type RefreshForm struct {
+	RefreshToken string `json:"refresh_token" form:"refresh_token" binding:"required"`
+}
+
 type LoginFunc func(ctx context.Context, form LoginForm) (jwt.MapClaims, error)
 type GenerateTokenFunc func(loginFunc LoginFunc) (jwt.Token, error)
 
@@ -33,12 +51,26 @@ type JWTFactory struct {
 	publicKeyFile    string
 	privateKeyFile   string
 	timeout          time.Duration
+	refreshTimeout   time.Duration
+	issuer           string
+	audience         []string
+	leeway           time.Duration
 	loginFunc        LoginFunc
+	authenticators   map[string]Authenticator
+	newClaims        func() interface{}
+	privateSignKey   crypto.PrivateKey
+	publicSignKey    crypto.PublicKey
+	keyID            string
+	rotationInterval time.Duration
+	jwksURL          string
+	jwksCacheTTL     time.Duration
 
-	signKey        interface{}
-	decodeKey      interface{}
-	privateSignKey *rsa.PrivateKey
-	publicSignKey  *rsa.PublicKey
+	keys       *KeySet
+	verifier   KeyProvider
+	revocation RevocationStore
+	generator  KeyGenerator
+	stop       chan struct{}
+	closeOnce  *sync.Once
 }
 type Option func(factory *JWTFactory)
 
@@ -57,29 +89,108 @@ func WithPrivateKeyFile(key string) Option {
 		factory.privateKeyFile = key
 	}
 }
+
+// WithPrivateKey signs with key instead of PrivateKeyFile, an *rsa.PrivateKey,
+// *ecdsa.PrivateKey or ed25519.PrivateKey fitting the signing algorithm.
+func WithPrivateKey(key crypto.PrivateKey) Option {
+	return func(factory *JWTFactory) {
+		factory.privateSignKey = key
+	}
+}
+
+// WithPublicKey verifies with key instead of PublicKeyFile, it defaults to
+// the public half of the private key.
+func WithPublicKey(key crypto.PublicKey) Option {
+	return func(factory *JWTFactory) {
+		factory.publicSignKey = key
+	}
+}
+
 func WithTimeout(duration time.Duration) Option {
 	return func(factory *JWTFactory) {
 		factory.timeout = duration
 	}
 }
 
+func WithRefreshTimeout(duration time.Duration) Option {
+	return func(factory *JWTFactory) {
+		factory.refreshTimeout = duration
+	}
+}
+
 func WithLoginFunc(f LoginFunc) Option {
 	return func(factory *JWTFactory) {
 		factory.loginFunc = f
 	}
 }
 
+// WithKeySet signs and verifies with keys instead of the configured key.
+func WithKeySet(keys *KeySet) Option {
+	return func(factory *JWTFactory) {
+		factory.keys = keys
+	}
+}
+
+// WithKeyProvider verifies tokens with provider, e.g. a RemoteKeySet, the
+// factory can't sign tokens unless a signing key is configured as well.
+func WithKeyProvider(provider KeyProvider) Option {
+	return func(factory *JWTFactory) {
+		factory.verifier = provider
+	}
+}
+
+// WithRevocationStore checks tokens against store and enables Revoke.
+func WithRevocationStore(store RevocationStore) Option {
+	return func(factory *JWTFactory) {
+		factory.revocation = store
+	}
+}
+
+// WithRotation generates a new signing key with generator every interval,
+// retired keys keep verifying for the token timeout.
+func WithRotation(interval time.Duration, generator KeyGenerator) Option {
+	return func(factory *JWTFactory) {
+		factory.rotationInterval = interval
+		factory.generator = generator
+	}
+}
+
 func NewJWTFactory(config Config, opts ...Option) (*JWTFactory, error) {
 	d, err := time.ParseDuration(config.Timeout)
 	if err != nil {
 		d = time.Minute * 10
 	}
+	rd, err := time.ParseDuration(config.RefreshTimeout)
+	if err != nil {
+		rd = time.Hour * 24 * 7
+	}
 	jm := &JWTFactory{
 		singingAlgorithm: config.SingingAlgorithm,
 		key:              []byte(config.Key),
 		publicKeyFile:    config.PublicKeyFile,
 		privateKeyFile:   config.PrivateKeyFile,
 		timeout:          d,
+		refreshTimeout:   rd,
+		issuer:           config.Issuer,
+		audience:         config.Audience,
+		keyID:            config.KeyID,
+		jwksURL:          config.JWKSURL,
+		revocation:       NewRevocationStore(config.Revocation),
+	}
+	if config.RotationInterval != "" {
+		if jm.rotationInterval, err = time.ParseDuration(config.RotationInterval); err != nil {
+			return jm, err
+		}
+	}
+	if config.Leeway != "" {
+		if jm.leeway, err = time.ParseDuration(config.Leeway); err != nil {
+			return jm, err
+		}
+	}
+	if config.JWKSCacheTTL != "" {
+		if jm.jwksCacheTTL, err = time.ParseDuration(config.JWKSCacheTTL); err != nil {
+			return jm, err
+		}
 	}
 	for _, v := range opts {
 		v(jm)
@@ -89,111 +200,355 @@ func NewJWTFactory(config Config, opts ...Option) (*JWTFactory, error) {
 }
 
 func (f *JWTFactory) Init() (err error) {
-	f.signKey = f.key
-	f.decodeKey = f.key
-	if f.useRsaAlgorithm() {
-		if f.privateKeyFile != "" {
-			err = f.privateKey()
+	if f.keys == nil {
+		f.keys = NewKeySet()
+	}
+	if f.verifier == nil && f.jwksURL != "" {
+		f.verifier = NewRemoteKeySet(f.jwksURL, f.jwksCacheTTL, nil)
+	}
+	if len(f.keys.Keys()) == 0 && (f.verifier == nil || len(f.key) > 0 || f.privateKeyFile != "" || f.privateSignKey != nil) {
+		if err = f.loadKey(); err != nil {
+			return err
 		}
-		if f.publicKeyFile != "" {
-			err = f.publicKey()
+	}
+	if f.verifier == nil {
+		f.verifier = f.keys
+	}
+	if f.rotationInterval > 0 && !f.VerifyOnly() {
+		if err = f.startRotation(); err != nil {
+			return err
 		}
-		f.signKey = f.privateSignKey
-		f.decodeKey = f.publicSignKey
 	}
-	if f.loginFunc == nil {
-		log.Fatal("loginFunc can't be nil")
+	if _, ok := f.authenticators[GrantPassword]; !ok && f.loginFunc != nil {
+		if f.authenticators == nil {
+			f.authenticators = map[string]Authenticator{}
+		}
+		f.authenticators[GrantPassword] = PasswordAuthenticator(f.loginFunc)
 	}
-	return err
+	return nil
 }
 
-func (f *JWTFactory) privateKey() error {
-	keyData, err := ioutil.ReadFile(f.privateKeyFile)
-	if err != nil {
+// loadKey adds the key configured by Key, the PEM files or the raw key
+// options to the key set, checking that it fits the signing algorithm.
+func (f *JWTFactory) loadKey() error {
+	if algorithmFamily(f.singingAlgorithm) == familyHMAC {
+		if err := checkKey(f.singingAlgorithm, f.key); err != nil {
+			return err
+		}
+		f.keys.Add(Key{ID: f.keyID, Algorithm: f.singingAlgorithm, Private: f.key, Public: f.key})
+		return nil
+	}
+	private, public := f.privateSignKey, f.publicSignKey
+	if private == nil && f.privateKeyFile != "" {
+		keyData, err := ioutil.ReadFile(f.privateKeyFile)
+		if err != nil {
+			return err
+		}
+		if private, err = ParsePrivateKeyPEM(keyData); err != nil {
+			return err
+		}
+	}
+	if public == nil && f.publicKeyFile != "" {
+		keyData, err := ioutil.ReadFile(f.publicKeyFile)
+		if err != nil {
+			return err
+		}
+		if public, err = ParsePublicKeyPEM(keyData); err != nil {
+			return err
+		}
+	}
+	if public == nil && private != nil {
+		public = publicOf(private)
+	}
+	if public == nil {
+		return ErrNoPrivateKeyFile
+	}
+	if err := checkKey(f.singingAlgorithm, public); err != nil {
 		return err
 	}
-	key, err := jwt.ParseRSAPrivateKeyFromPEM(keyData)
+	if private != nil {
+		if err := checkKey(f.singingAlgorithm, private); err != nil {
+			return err
+		}
+	}
+	key, err := newKey(f.keyID, f.singingAlgorithm, private, public)
 	if err != nil {
 		return err
 	}
-	f.privateSignKey = key
+	f.keys.Add(key)
 	return nil
 }
 
-func (f *JWTFactory) publicKey() error {
-	keyData, err := ioutil.ReadFile(f.publicKeyFile)
-	if err != nil {
-		return err
-	}
-	key, err := jwt.ParseRSAPublicKeyFromPEM(keyData)
-	if err != nil {
-		return err
+func (f *JWTFactory) startRotation() error {
+	if f.generator == nil {
+		switch algorithmFamily(f.singingAlgorithm) {
+		case familyRSA:
+			f.generator = RSAKeyGenerator(f.singingAlgorithm, 2048)
+		case familyECDSA:
+			f.generator = ECDSAKeyGenerator(f.singingAlgorithm)
+		case familyEd25519:
+			f.generator = Ed25519KeyGenerator()
+		case familyHMAC:
+			f.generator = HMACKeyGenerator(f.singingAlgorithm, 64)
+		default:
+			return fmt.Errorf("no key generator for %s rotation", f.singingAlgorithm)
+		}
 	}
-	f.publicSignKey = key
+	f.stop = make(chan struct{})
+	f.closeOnce = &sync.Once{}
+	go func() {
+		ticker := time.NewTicker(f.rotationInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				key, err := f.generator()
+				if err != nil {
+					xlog.SS().Errorf("generate jwt signing key error: %s", err)
+					continue
+				}
+				f.Rotate(key)
+				xlog.SS().Infof("rotate jwt signing key, kid=%s", key.ID)
+			case <-f.stop:
+				return
+			}
+		}
+	}()
 	return nil
 }
 
+// Close stops the scheduled key rotation.
+func (f *JWTFactory) Close() {
+	if f.closeOnce != nil {
+		f.closeOnce.Do(func() {
+			close(f.stop)
+		})
+	}
+}
+
+// Rotate makes key the signing key, tokens signed by the previous keys stay
+// valid until they expire, refresh tokens included.
+func (f JWTFactory) Rotate(key Key) {
+	f.keys.Rotate(key, f.maxLifetime())
+}
+
+// maxLifetime is how long a token signed now may stay valid, refresh tokens
+// of a TokenPair and RefreshToken outlive the access token timeout.
+func (f JWTFactory) maxLifetime() time.Duration {
+	if f.refreshTimeout > f.timeout {
+		return f.refreshTimeout
+	}
+	return f.timeout
+}
+
+// KeySet returns the local signing and verification keys.
+func (f JWTFactory) KeySet() *KeySet {
+	return f.keys
+}
+
+// JWKS returns the public verification keys, see JWKSHandler.
+func (f JWTFactory) JWKS() JSONWebKeySet {
+	return f.keys.JWKS()
+}
+
+// VerifyOnly reports whether the factory lacks a signing key, tokens are
+// verified against public or remote keys only.
+func (f JWTFactory) VerifyOnly() bool {
+	key, ok := f.keys.Active()
+	return !ok || key.Private == nil
+}
+
+// GenerateToken logs in with the password grant.
 func (f JWTFactory) GenerateToken(ctx context.Context, form LoginForm) (string, error) {
-	claims, err := f.loginFunc(ctx, form)
-	if err != nil {
-		return "", err
+	return f.GenerateTokenForGrant(ctx, GrantRequest{GrantType: GrantPassword, Username: form.Username, Password: form.Password})
+}
+
+// GenerateTokenWithClaims signs claims without going through LoginFunc, it is
+// meant for service to service tokens. exp, iat, nbf, iss and aud are set
+// from the factory, jti is generated unless claims has one.
+func (f JWTFactory) GenerateTokenWithClaims(claims jwt.MapClaims) (string, error) {
+	f.stamp(claims, time.Now(), f.timeout)
+	if _, ok := claims["jti"]; !ok {
+		jti, err := newTokenID()
+		if err != nil {
+			return "", err
+		}
+		claims["jti"] = jti
 	}
-	claims["exp"] = time.Now().Add(f.timeout).Unix()
-	token := jwt.NewWithClaims(jwt.GetSigningMethod(f.singingAlgorithm), claims)
-	s, err := token.SignedString(f.signKey)
-	if err != nil {
+	return f.sign(claims)
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
-	return s, err
+	return encodeSegment(b), nil
+}
+
+// sign signs claims with the active key, naming it in the kid header.
+func (f JWTFactory) sign(claims jwt.MapClaims) (string, error) {
+	key, ok := f.keys.Active()
+	if !ok || key.Private == nil {
+		return "", ErrVerifyOnly
+	}
+	method := jwt.GetSigningMethod(key.Algorithm)
+	if method == nil {
+		return "", fmt.Errorf("unknown signing algorithm %q", key.Algorithm)
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.Private)
+}
+
+// Timeout returns how long generated tokens stay valid.
+func (f JWTFactory) Timeout() time.Duration {
+	return f.timeout
 }
 
 func (f JWTFactory) VerifyToken(token string) bool {
-	t, _ := f.parseToken(token)
-	return t.Valid
+	_, err := f.GetClaims(token)
+	return err == nil
 }
 
+// RefreshToken re-signs a valid access token with a new exp, at most until
+// the refresh timeout has passed since the original token was issued.
+//
+// Deprecated: a stolen token can be extended until then, use
+// GenerateTokenPair and Refresh instead.
 func (f JWTFactory) RefreshToken(token string) (string, error) {
 	claims, err := f.GetClaims(token)
 	if err != nil {
 		return "", err
 	}
-	claims["exp"] = time.Now().Add(f.timeout).Unix()
-	t := jwt.NewWithClaims(jwt.GetSigningMethod(f.singingAlgorithm), claims)
-	s, err := t.SignedString(f.signKey)
-	if err != nil {
-		return "", err
+	if _, ok := claims[claimFamily]; ok {
+		return "", ErrTokenPair
 	}
-	return s, err
+	origIat, ok := claims["orig_iat"].(float64)
+	if !ok {
+		origIat, ok = claims["iat"].(float64)
+	}
+	if !ok {
+		exp, _ := claims["exp"].(float64)
+		origIat = float64(time.Unix(int64(exp), 0).Add(-f.timeout).Unix())
+	}
+	if time.Since(time.Unix(int64(origIat), 0)) > f.refreshTimeout {
+		return "", ErrRefreshExpired
+	}
+	claims["orig_iat"] = int64(origIat)
+	delete(claims, "jti")
+	return f.GenerateTokenWithClaims(claims)
 }
 
 func (f JWTFactory) GetClaims(token string) (jwt.MapClaims, error) {
+	return f.GetClaimsContext(context.Background(), token)
+}
+
+// GetClaimsContext is GetClaims that also rejects revoked tokens.
+func (f JWTFactory) GetClaimsContext(ctx context.Context, token string) (jwt.MapClaims, error) {
 	t, err := f.parseToken(token)
 	if err != nil {
 		return jwt.MapClaims{}, err
 	}
-	return t.Claims.(jwt.MapClaims), nil
+	claims := t.Claims.(jwt.MapClaims)
+	if typ, _ := claims[claimType].(string); typ == typeRefresh {
+		return jwt.MapClaims{}, ErrNotAccessToken
+	}
+	if err := f.checkRevoked(ctx, claims); err != nil {
+		return jwt.MapClaims{}, err
+	}
+	return claims, nil
+}
+
+func (f JWTFactory) checkRevoked(ctx context.Context, claims jwt.MapClaims) error {
+	return f.checkRevokedExcept(ctx, claims, false)
+}
+
+// checkRevokedExcept skips the jti check when skipJTI is set, for refresh
+// tokens whose jti is revoked once they are spent.
+func (f JWTFactory) checkRevokedExcept(ctx context.Context, claims jwt.MapClaims, skipJTI bool) error {
+	if f.revocation == nil {
+		return nil
+	}
+	ids := make([]string, 0, 2)
+	if jti, ok := claims["jti"].(string); ok && !skipJTI {
+		ids = append(ids, jti)
+	}
+	if family, ok := claims[claimFamily].(string); ok {
+		ids = append(ids, familyID(family))
+	}
+	for _, id := range ids {
+		revoked, err := f.revocation.IsRevoked(ctx, id)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return ErrTokenRevoked
+		}
+	}
+	if sub := subject(claims); sub != "" {
+		before, err := f.revocation.RevokedBefore(ctx, sub)
+		if err != nil {
+			return err
+		}
+		iat, _ := claims["iat"].(float64)
+		if !before.IsZero() && int64(iat) < before.Unix() {
+			return ErrTokenRevoked
+		}
+	}
+	return nil
+}
+
+// Revoke makes token invalid until it expires, expired tokens are ignored.
+func (f JWTFactory) Revoke(ctx context.Context, token string) error {
+	if f.revocation == nil {
+		return ErrRevocationDisabled
+	}
+	t, err := f.parseToken(token)
+	if err != nil {
+		if err == ErrTokenExpired {
+			return nil
+		}
+		return err
+	}
+	claims := t.Claims.(jwt.MapClaims)
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return ErrNoTokenID
+	}
+	exp, _ := claims["exp"].(float64)
+	return f.revocation.Revoke(ctx, jti, time.Unix(int64(exp), 0))
 }
 
-func (f JWTFactory) parseToken(token string) (*jwt.Token, error) {
-	return jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		return f.decodeKey, nil
-	})
+// RevokeSubject revokes every token whose sub claim is subject and that was
+// issued before before, at second precision.
+func (f JWTFactory) RevokeSubject(ctx context.Context, subject string, before time.Time) error {
+	if f.revocation == nil {
+		return ErrRevocationDisabled
+	}
+	return f.revocation.RevokeSubject(ctx, subject, before, f.maxLifetime())
 }
 
-func (f *JWTFactory) useRsaAlgorithm() bool {
-	switch f.singingAlgorithm {
-	case "RS256", "RS512", "RS384":
-		return true
+func subject(claims jwt.MapClaims) string {
+	switch sub := claims["sub"].(type) {
+	case string:
+		return sub
+	case float64:
+		return strconv.FormatFloat(sub, 'f', -1, 64)
 	}
-	return false
+	return ""
 }
 
+// GetClaimsFromCtx returns the claims put by SetClaimsToCtx, empty claims
+// when there are none.
 func GetClaimsFromCtx(ctx context.Context) jwt.MapClaims {
-	res := ctx.Value(CtxJWTKey)
-	if res == nil {
+	claims, ok := ctx.Value(CtxJWTKey).(jwt.MapClaims)
+	if !ok {
 		return jwt.MapClaims{}
 	}
-	return res.(jwt.MapClaims)
+	return claims
 }
 
 func SetClaimsToCtx(ctx context.Context, claims jwt.MapClaims) context.Context {
@@ -0,0 +1,204 @@
+package xjwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrKeyNotFound       = errors.New("jwt key not found")
+	ErrAlgorithmMismatch = errors.New("jwt algorithm does not match the key")
+)
+
+// Key is a signing or verification key. Private is nil for keys that can only
+// verify, for HMAC algorithms Private and Public are the same []byte.
+type Key struct {
+	ID        string
+	Algorithm string
+	Private   interface{}
+	Public    interface{}
+}
+
+// allows reports whether a token signed with alg may be verified by k, a key
+// without algorithm, as published by some JWKS, allows its whole family.
+func (k Key) allows(alg string) bool {
+	if k.Algorithm != "" {
+		return k.Algorithm == alg
+	}
+	return checkKey(alg, k.Public) == nil
+}
+
+// KeyProvider looks verification keys up by kid.
+type KeyProvider interface {
+	Lookup(kid string) (Key, error)
+}
+
+// KeyGenerator makes the next signing key of a scheduled rotation.
+type KeyGenerator func() (Key, error)
+
+// RSAKeyGenerator generates RSA keys of bits for alg, identified by their thumbprint.
+func RSAKeyGenerator(alg string, bits int) KeyGenerator {
+	return func() (Key, error) {
+		private, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return Key{}, err
+		}
+		return newKey("", alg, private, &private.PublicKey)
+	}
+}
+
+// HMACKeyGenerator generates random secrets of size bytes for alg.
+func HMACKeyGenerator(alg string, size int) KeyGenerator {
+	return func() (Key, error) {
+		secret := make([]byte, size)
+		if _, err := rand.Read(secret); err != nil {
+			return Key{}, err
+		}
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			return Key{}, err
+		}
+		return Key{ID: encodeSegment(id), Algorithm: alg, Private: secret, Public: secret}, nil
+	}
+}
+
+// newKey fills the kid of an asymmetric key with its thumbprint when id is empty.
+func newKey(id, alg string, private, public interface{}) (Key, error) {
+	if id == "" {
+		jwk, err := NewJSONWebKey("", alg, public)
+		if err != nil {
+			return Key{}, err
+		}
+		if id, err = jwk.Thumbprint(); err != nil {
+			return Key{}, err
+		}
+	}
+	return Key{ID: id, Algorithm: alg, Private: private, Public: public}, nil
+}
+
+// NewKeySet returns an empty KeySet.
+func NewKeySet() *KeySet {
+	return &KeySet{keys: make(map[string]*keyEntry)}
+}
+
+// KeySet holds the keys of a factory indexed by kid, one of them signs new tokens.
+type KeySet struct {
+	mu     sync.RWMutex
+	keys   map[string]*keyEntry
+	order  []string
+	active string
+}
+
+type keyEntry struct {
+	key     Key
+	retired time.Time
+}
+
+// Add adds key for verification, the first key added becomes the active one.
+func (s *KeySet) Add(key Key) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(key)
+}
+
+func (s *KeySet) add(key Key) {
+	if _, ok := s.keys[key.ID]; !ok {
+		s.order = append(s.order, key.ID)
+	}
+	s.keys[key.ID] = &keyEntry{key: key}
+	if len(s.keys) == 1 {
+		s.active = key.ID
+	}
+}
+
+// Remove drops the key of kid, the active key can't be removed.
+func (s *KeySet) Remove(kid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if kid == s.active {
+		return
+	}
+	s.remove(kid)
+}
+
+func (s *KeySet) remove(kid string) {
+	delete(s.keys, kid)
+	for i, id := range s.order {
+		if id == kid {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Rotate makes key the active signing key. The keys it replaces keep
+// verifying for retain, after which the next rotation drops them.
+func (s *KeySet) Rotate(key Key, retain time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, id := range append([]string(nil), s.order...) {
+		entry := s.keys[id]
+		if !entry.retired.IsZero() && now.Sub(entry.retired) > retain {
+			s.remove(id)
+		}
+	}
+	if entry, ok := s.keys[s.active]; ok {
+		entry.retired = now
+	}
+	s.add(key)
+	s.active = key.ID
+}
+
+// Active returns the signing key.
+func (s *KeySet) Active() (Key, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.keys[s.active]
+	if !ok {
+		return Key{}, false
+	}
+	return entry.key, true
+}
+
+// Lookup returns the key of kid, tokens without kid are verified by the key
+// without id if there is one, by the active key otherwise.
+func (s *KeySet) Lookup(kid string) (Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.keys[kid]
+	if !ok && kid == "" {
+		entry, ok = s.keys[s.active]
+	}
+	if !ok {
+		return Key{}, ErrKeyNotFound
+	}
+	return entry.key, nil
+}
+
+// Keys returns all keys in the order they were added.
+func (s *KeySet) Keys() []Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]Key, 0, len(s.order))
+	for _, id := range s.order {
+		keys = append(keys, s.keys[id].key)
+	}
+	return keys
+}
+
+// JWKS returns the public keys as a JSON Web Key Set, secrets are never published.
+func (s *KeySet) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range s.Keys() {
+		jwk, err := NewJSONWebKey(key.ID, key.Algorithm, key.Public)
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
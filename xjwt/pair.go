@@ -0,0 +1,161 @@
+package xjwt
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	claimType   = "typ"
+	claimFamily = "fam"
+	typeRefresh = "refresh"
+)
+
+var (
+	ErrNotRefreshToken    = errors.New("jwt token is not a refresh token")
+	ErrRefreshTokenReused = errors.New("jwt refresh token is reused, its family is revoked")
+	ErrRefreshExpired     = errors.New("jwt token can't be refreshed any more")
+	ErrTokenPair          = errors.New("jwt access token of a token pair is refreshed by its refresh token")
+)
+
+// TokenPair is a short lived access token and the one-time refresh token
+// that replaces both of them.
+type TokenPair struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in"`
+}
+
+// GenerateTokenPair logs in with the password grant and issues a TokenPair.
+func (f JWTFactory) GenerateTokenPair(ctx context.Context, form LoginForm) (TokenPair, error) {
+	return f.GenerateTokenPairForGrant(ctx, GrantRequest{GrantType: GrantPassword, Username: form.Username, Password: form.Password})
+}
+
+// GenerateTokenPairWithClaims issues a TokenPair for claims starting a new
+// token family. Every pair refreshed from it belongs to the same family, which
+// is revoked as a whole on logout or when a refresh token is used twice.
+func (f JWTFactory) GenerateTokenPairWithClaims(claims jwt.MapClaims) (TokenPair, error) {
+	family, err := newTokenID()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return f.issuePair(claims, family)
+}
+
+func (f JWTFactory) issuePair(claims jwt.MapClaims, family string) (TokenPair, error) {
+	access := jwt.MapClaims{}
+	refresh := jwt.MapClaims{}
+	for k, v := range claims {
+		switch k {
+		case "exp", "iat", "nbf", "iss", "aud", "jti", claimType, claimFamily:
+			continue
+		}
+		access[k] = v
+		refresh[k] = v
+	}
+	access[claimFamily] = family
+	accessToken, err := f.GenerateTokenWithClaims(access)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	jti, err := newTokenID()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	now := time.Now()
+	refresh[claimType] = typeRefresh
+	refresh[claimFamily] = family
+	refresh["jti"] = jti
+	f.stamp(refresh, now, f.refreshTimeout)
+	refreshToken, err := f.sign(refresh)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(f.timeout / time.Second),
+		RefreshExpiresIn: int64(f.refreshTimeout / time.Second),
+	}, nil
+}
+
+// Refresh spends refreshToken for a new TokenPair of the same family. A
+// refresh token that was already spent revokes the family, as either the
+// client or an attacker holds a stolen copy. It needs a revocation store.
+func (f JWTFactory) Refresh(ctx context.Context, refreshToken string) (TokenPair, error) {
+	if f.revocation == nil {
+		return TokenPair{}, ErrRevocationDisabled
+	}
+	claims, err := f.refreshClaims(ctx, refreshToken)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	family, _ := claims[claimFamily].(string)
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+	first, err := f.revocation.RevokeOnce(ctx, jti, time.Unix(int64(exp), 0))
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if !first {
+		if err := f.revokeFamily(ctx, family); err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{}, ErrRefreshTokenReused
+	}
+	return f.issuePair(claims, family)
+}
+
+// Logout revokes token and, when it belongs to a token family, every access
+// and refresh token of that family. token may be either kind.
+func (f JWTFactory) Logout(ctx context.Context, token string) error {
+	if f.revocation == nil {
+		return ErrRevocationDisabled
+	}
+	t, err := f.parseToken(token)
+	if err != nil {
+		return err
+	}
+	claims := t.Claims.(jwt.MapClaims)
+	if family, ok := claims[claimFamily].(string); ok {
+		return f.revokeFamily(ctx, family)
+	}
+	return f.Revoke(ctx, token)
+}
+
+// refreshClaims verifies a refresh token, which GetClaims refuses.
+func (f JWTFactory) refreshClaims(ctx context.Context, token string) (jwt.MapClaims, error) {
+	t, err := f.parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	claims := t.Claims.(jwt.MapClaims)
+	if typ, _ := claims[claimType].(string); typ != typeRefresh {
+		return nil, ErrNotRefreshToken
+	}
+	if family, _ := claims[claimFamily].(string); family == "" {
+		return nil, ErrNotRefreshToken
+	}
+	if jti, _ := claims["jti"].(string); jti == "" {
+		return nil, ErrNoTokenID
+	}
+	if err := f.checkRevokedExcept(ctx, claims, true); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (f JWTFactory) revokeFamily(ctx context.Context, family string) error {
+	return f.revocation.Revoke(ctx, familyID(family), time.Now().Add(f.refreshTimeout))
+}
+
+func familyID(family string) string {
+	return claimFamily + ":" + family
+}
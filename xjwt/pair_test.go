@@ -0,0 +1,138 @@
+package xjwt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTFactory_Refresh(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+	f := newRevocableFactory(t, NewMemoryRevocationStore())
+
+	pair, err := f.GenerateTokenPair(ctx, LoginForm{Username: "u", Password: "p"})
+	assert.NoError(err)
+	assert.Equal("Bearer", pair.TokenType)
+	assert.Equal(int64(600), pair.ExpiresIn)
+	assert.Equal(int64(7*24*3600), pair.RefreshExpiresIn)
+	claims, err := f.GetClaims(pair.AccessToken)
+	assert.NoError(err)
+	assert.Equal("u", claims["username"])
+
+	// refresh tokens are not access tokens and the other way around
+	_, err = f.GetClaims(pair.RefreshToken)
+	assert.Equal(ErrNotAccessToken, err)
+	_, err = f.Refresh(ctx, pair.AccessToken)
+	assert.Equal(ErrNotRefreshToken, err)
+
+	next, err := f.Refresh(ctx, pair.RefreshToken)
+	assert.NoError(err)
+	claims, err = f.GetClaims(next.AccessToken)
+	assert.NoError(err)
+	assert.Equal("u", claims["username"])
+	assert.True(f.VerifyToken(pair.AccessToken))
+
+	// spending a refresh token twice revokes the whole family
+	_, err = f.Refresh(ctx, pair.RefreshToken)
+	assert.Equal(ErrRefreshTokenReused, err)
+	assert.False(f.VerifyToken(pair.AccessToken))
+	assert.False(f.VerifyToken(next.AccessToken))
+	_, err = f.Refresh(ctx, next.RefreshToken)
+	assert.Equal(ErrTokenRevoked, err)
+}
+
+func TestJWTFactory_RevokeSubjectRefresh(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+	f := newRevocableFactory(t, store)
+
+	pair, err := f.GenerateTokenPairWithClaims(jwt.MapClaims{"sub": "42"})
+	assert.NoError(err)
+	assert.NoError(f.RevokeSubject(ctx, "42", time.Now().Add(time.Second)))
+
+	// the access token timeout has passed, the refresh token is still valid
+	later := time.Now().Add(11 * time.Minute)
+	store.now = func() time.Time { return later }
+	_, err = f.Refresh(ctx, pair.RefreshToken)
+	assert.Equal(ErrTokenRevoked, err)
+}
+
+func TestJWTFactory_RotateKeepsRefreshKeys(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+	f, err := NewJWTFactory(Config{
+		SingingAlgorithm: "RS256",
+		PrivateKeyFile:   "./testData/zq_mall_rsa_private_key.pem",
+		Timeout:          "10m",
+	}, WithLoginFunc(login), WithRevocationStore(NewMemoryRevocationStore()))
+	assert.NoError(err)
+	first, _ := f.KeySet().Active()
+	pair, err := f.GenerateTokenPairWithClaims(jwt.MapClaims{"sub": "42"})
+	assert.NoError(err)
+
+	next, err := RSAKeyGenerator("RS256", 1024)()
+	assert.NoError(err)
+	f.Rotate(next)
+	// the first key retired longer than the access token timeout ago
+	f.KeySet().keys[first.ID].retired = time.Now().Add(-11 * time.Minute)
+	last, err := RSAKeyGenerator("RS256", 1024)()
+	assert.NoError(err)
+	f.Rotate(last)
+
+	_, err = f.KeySet().Lookup(first.ID)
+	assert.NoError(err)
+	_, err = f.Refresh(ctx, pair.RefreshToken)
+	assert.NoError(err)
+}
+
+func TestJWTFactory_Logout(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+	f := newRevocableFactory(t, NewMemoryRevocationStore())
+
+	pair, err := f.GenerateTokenPairWithClaims(jwt.MapClaims{"sub": "1"})
+	assert.NoError(err)
+	other, err := f.GenerateTokenPairWithClaims(jwt.MapClaims{"sub": "1"})
+	assert.NoError(err)
+	assert.NoError(f.Logout(ctx, pair.AccessToken))
+	assert.False(f.VerifyToken(pair.AccessToken))
+	_, err = f.Refresh(ctx, pair.RefreshToken)
+	assert.Equal(ErrTokenRevoked, err)
+	assert.True(f.VerifyToken(other.AccessToken))
+
+	_, err = factory.Refresh(ctx, other.RefreshToken)
+	assert.Equal(ErrRevocationDisabled, err)
+}
+
+func TestJWTFactory_RefreshToken(t *testing.T) {
+	assert := require.New(t)
+	f, err := NewJWTFactory(Config{SingingAlgorithm: "HS256", Key: "secret", RefreshTimeout: "1h"}, WithLoginFunc(login))
+	assert.NoError(err)
+
+	token, err := f.GenerateTokenWithClaims(jwt.MapClaims{"id": 1})
+	assert.NoError(err)
+	refreshed, err := f.RefreshToken(token)
+	assert.NoError(err)
+	claims, err := f.GetClaims(refreshed)
+	assert.NoError(err)
+	assert.NotEmpty(claims["orig_iat"])
+
+	old, err := f.sign(jwt.MapClaims{
+		"id":  1,
+		"iat": time.Now().Add(-2 * time.Hour).Unix(),
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	assert.NoError(err)
+	_, err = f.RefreshToken(old)
+	assert.Equal(ErrRefreshExpired, err)
+
+	pair, err := f.GenerateTokenPairWithClaims(jwt.MapClaims{"id": 1})
+	assert.NoError(err)
+	_, err = f.RefreshToken(pair.AccessToken)
+	assert.Equal(ErrTokenPair, err)
+}
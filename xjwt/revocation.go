@@ -0,0 +1,216 @@
+package xjwt
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+
+	"github.com/donech/tool/redis"
+)
+
+const (
+	RevocationMemory = "memory"
+	RevocationRedis  = "redis"
+)
+
+var defaultRevocationKeyPrefix = "jwt:revoked:"
+
+// sweepInterval how often expired entries are dropped from the memory store.
+var sweepInterval = time.Minute
+
+type RevocationConfig struct {
+	// Backend memory or redis, revocation is disabled when empty.
+	Backend string `yaml:"backend"`
+	// RedisName name of the client registered through redis.New, default redis.Default.
+	RedisName string `yaml:"redisName"`
+	// KeyPrefix prefix of redis keys, default jwt:revoked:.
+	KeyPrefix string `yaml:"keyPrefix"`
+}
+
+// RevocationStore remembers revoked tokens until they would have expired anyway.
+type RevocationStore interface {
+	// Revoke revokes the token of jti, expireAt is the token exp.
+	Revoke(ctx context.Context, jti string, expireAt time.Time) error
+	// RevokeOnce is Revoke that reports false when jti was already revoked,
+	// atomically so that a refresh token can only be used once.
+	RevokeOnce(ctx context.Context, jti string, expireAt time.Time) (bool, error)
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	// RevokeSubject revokes the tokens of subject issued before before, ttl is
+	// how long such tokens may stay valid.
+	RevokeSubject(ctx context.Context, subject string, before time.Time, ttl time.Duration) error
+	// RevokedBefore returns the time set by RevokeSubject, zero if there is none.
+	RevokedBefore(ctx context.Context, subject string) (time.Time, error)
+}
+
+// NewRevocationStore builds a RevocationStore from conf, nil when it is disabled.
+func NewRevocationStore(conf RevocationConfig) RevocationStore {
+	switch conf.Backend {
+	case RevocationMemory:
+		return NewMemoryRevocationStore()
+	case RevocationRedis:
+		name := conf.RedisName
+		if name == "" {
+			name = redis.Default
+		}
+		return NewRedisRevocationStore(redis.Redis(name), conf.KeyPrefix)
+	}
+	return nil
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens:   make(map[string]time.Time),
+		subjects: make(map[string]revokedSubject),
+		now:      time.Now,
+	}
+}
+
+// MemoryRevocationStore only suits a single instance.
+type MemoryRevocationStore struct {
+	mu        sync.Mutex
+	tokens    map[string]time.Time
+	subjects  map[string]revokedSubject
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type revokedSubject struct {
+	before   time.Time
+	expireAt time.Time
+}
+
+func (s *MemoryRevocationStore) Revoke(ctx context.Context, jti string, expireAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+	s.tokens[jti] = expireAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) RevokeOnce(ctx context.Context, jti string, expireAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+	if current, ok := s.tokens[jti]; ok && s.now().Before(current) {
+		return false, nil
+	}
+	s.tokens[jti] = expireAt
+	return true, nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expireAt, ok := s.tokens[jti]
+	return ok && s.now().Before(expireAt), nil
+}
+
+func (s *MemoryRevocationStore) RevokeSubject(ctx context.Context, subject string, before time.Time, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+	if current, ok := s.subjects[subject]; ok && current.before.After(before) {
+		return nil
+	}
+	s.subjects[subject] = revokedSubject{before: before, expireAt: before.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryRevocationStore) RevokedBefore(ctx context.Context, subject string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	revoked, ok := s.subjects[subject]
+	if !ok || !s.now().Before(revoked.expireAt) {
+		return time.Time{}, nil
+	}
+	return revoked.before, nil
+}
+
+// sweep drops entries whose tokens have expired.
+func (s *MemoryRevocationStore) sweep() {
+	now := s.now()
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for jti, expireAt := range s.tokens {
+		if !now.Before(expireAt) {
+			delete(s.tokens, jti)
+		}
+	}
+	for subject, revoked := range s.subjects {
+		if !now.Before(revoked.expireAt) {
+			delete(s.subjects, subject)
+		}
+	}
+}
+
+// NewRedisRevocationStore shares revocations between instances through redis.
+func NewRedisRevocationStore(client *goredis.Client, prefix string) *RedisRevocationStore {
+	if prefix == "" {
+		prefix = defaultRevocationKeyPrefix
+	}
+	return &RedisRevocationStore{client: client, prefix: prefix}
+}
+
+type RedisRevocationStore struct {
+	client *goredis.Client
+	prefix string
+}
+
+// revokeSubjectScript keeps the latest revocation time of a subject.
+var revokeSubjectScript = goredis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or 0)
+if current < tonumber(ARGV[1]) then
+  redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+end
+return 1
+`)
+
+func (s *RedisRevocationStore) Revoke(ctx context.Context, jti string, expireAt time.Time) error {
+	ttl := time.Until(expireAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.WithContext(ctx).Set(s.prefix+"jti:"+jti, 1, ttl).Err()
+}
+
+func (s *RedisRevocationStore) RevokeOnce(ctx context.Context, jti string, expireAt time.Time) (bool, error) {
+	ttl := time.Until(expireAt)
+	if ttl <= 0 {
+		return false, nil
+	}
+	return s.client.WithContext(ctx).SetNX(s.prefix+"jti:"+jti, 1, ttl).Result()
+}
+
+func (s *RedisRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := s.client.WithContext(ctx).Exists(s.prefix + "jti:" + jti).Result()
+	return n > 0, err
+}
+
+func (s *RedisRevocationStore) RevokeSubject(ctx context.Context, subject string, before time.Time, ttl time.Duration) error {
+	ttl = time.Until(before.Add(ttl))
+	if ttl <= 0 {
+		return nil
+	}
+	return revokeSubjectScript.Run(s.client.WithContext(ctx), []string{s.prefix + "sub:" + subject},
+		before.Unix(), ttl.Milliseconds()).Err()
+}
+
+func (s *RedisRevocationStore) RevokedBefore(ctx context.Context, subject string) (time.Time, error) {
+	v, err := s.client.WithContext(ctx).Get(s.prefix + "sub:" + subject).Result()
+	if err == goredis.Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0), nil
+}
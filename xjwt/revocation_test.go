@@ -0,0 +1,88 @@
+package xjwt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	goredis "github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func newRevocableFactory(t *testing.T, store RevocationStore) *JWTFactory {
+	f, err := NewJWTFactory(Config{SingingAlgorithm: "HS256", Key: "secret", Timeout: "10m"},
+		WithLoginFunc(login), WithRevocationStore(store))
+	require.NoError(t, err)
+	return f
+}
+
+func testRevocation(t *testing.T, store RevocationStore) {
+	assert := require.New(t)
+	ctx := context.Background()
+	f := newRevocableFactory(t, store)
+
+	token, err := f.GenerateTokenWithClaims(jwt.MapClaims{"sub": "42"})
+	assert.NoError(err)
+	other, err := f.GenerateTokenWithClaims(jwt.MapClaims{"sub": "42"})
+	assert.NoError(err)
+	claims, err := f.GetClaimsContext(ctx, token)
+	assert.NoError(err)
+	assert.NotEmpty(claims["jti"])
+	assert.NotEmpty(claims["iat"])
+
+	assert.NoError(f.Revoke(ctx, token))
+	_, err = f.GetClaimsContext(ctx, token)
+	assert.Equal(ErrTokenRevoked, err)
+	assert.False(f.VerifyToken(token))
+	assert.True(f.VerifyToken(other))
+
+	assert.NoError(f.RevokeSubject(ctx, "42", time.Now().Add(time.Second)))
+	_, err = f.GetClaimsContext(ctx, other)
+	assert.Equal(ErrTokenRevoked, err)
+
+	fresh, err := f.GenerateTokenWithClaims(jwt.MapClaims{"sub": "7"})
+	assert.NoError(err)
+	assert.True(f.VerifyToken(fresh))
+}
+
+func TestMemoryRevocationStore(t *testing.T) {
+	testRevocation(t, NewMemoryRevocationStore())
+}
+
+func TestRedisRevocationStore(t *testing.T) {
+	client := goredis.NewClient(&goredis.Options{Addr: ":6379"})
+	if err := client.Ping().Err(); err != nil {
+		t.Skip("redis is not available: ", err)
+	}
+	defer client.Close()
+	testRevocation(t, NewRedisRevocationStore(client, "test:jwt:revoked:"))
+}
+
+func TestMemoryRevocationStore_Sweep(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+	now := time.Now()
+	s := NewMemoryRevocationStore()
+	s.now = func() time.Time { return now }
+	assert.NoError(s.Revoke(ctx, "a", now.Add(time.Minute)))
+	assert.NoError(s.RevokeSubject(ctx, "42", now, time.Minute))
+
+	now = now.Add(2 * time.Minute)
+	revoked, err := s.IsRevoked(ctx, "a")
+	assert.NoError(err)
+	assert.False(revoked)
+	before, err := s.RevokedBefore(ctx, "42")
+	assert.NoError(err)
+	assert.True(before.IsZero())
+	assert.NoError(s.Revoke(ctx, "b", now.Add(time.Minute)))
+	assert.Len(s.tokens, 1)
+	assert.Empty(s.subjects)
+}
+
+func TestJWTFactory_RevokeDisabled(t *testing.T) {
+	assert := require.New(t)
+	token, err := factory.GenerateTokenWithClaims(jwt.MapClaims{"sub": "1"})
+	assert.NoError(err)
+	assert.Equal(ErrRevocationDisabled, factory.Revoke(context.Background(), token))
+}
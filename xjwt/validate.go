@@ -0,0 +1,168 @@
+package xjwt
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Verification errors returned by GetClaims and friends, ErrorReason turns
+// them into short codes for responses.
+var (
+	ErrTokenMalformed    = errors.New("jwt token is malformed")
+	ErrSignatureInvalid  = errors.New("jwt signature is invalid")
+	ErrTokenExpired      = errors.New("jwt token is expired")
+	ErrTokenNotValidYet  = errors.New("jwt token is not valid yet")
+	ErrInvalidIssuer     = errors.New("jwt token has an unexpected issuer")
+	ErrInvalidAudience   = errors.New("jwt token is not meant for this audience")
+	ErrMissingExpiration = errors.New("jwt token has no exp")
+)
+
+// ErrorReason returns a stable code for the verification errors of xjwt,
+// "invalid_token" for any other error.
+func ErrorReason(err error) string {
+	switch {
+	case errors.Is(err, ErrTokenExpired):
+		return "token_expired"
+	case errors.Is(err, ErrTokenNotValidYet):
+		return "token_not_valid_yet"
+	case errors.Is(err, ErrSignatureInvalid), errors.Is(err, ErrAlgorithmMismatch), errors.Is(err, ErrKeyNotFound):
+		return "invalid_signature"
+	case errors.Is(err, ErrInvalidIssuer):
+		return "invalid_issuer"
+	case errors.Is(err, ErrInvalidAudience):
+		return "invalid_audience"
+	case errors.Is(err, ErrTokenRevoked):
+		return "token_revoked"
+	case errors.Is(err, ErrInvalidClaims):
+		return "invalid_claims"
+	}
+	return "invalid_token"
+}
+
+// parseToken verifies the signature with the key of the kid header, then the
+// registered claims with leeway.
+func (f JWTFactory) parseToken(token string) (*jwt.Token, error) {
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	t, err := parser.Parse(token, f.keyFunc)
+	if err != nil {
+		return t, parseError(err)
+	}
+	if err := f.validateClaims(t.Claims.(jwt.MapClaims), time.Now()); err != nil {
+		t.Valid = false
+		return t, err
+	}
+	return t, nil
+}
+
+// keyFunc picks the verification key by the kid header, refusing any
+// algorithm other than the configured one before a key is even looked up.
+func (f JWTFactory) keyFunc(token *jwt.Token) (interface{}, error) {
+	if f.singingAlgorithm != "" && token.Method.Alg() != f.singingAlgorithm {
+		return nil, ErrAlgorithmMismatch
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, err := f.verifier.Lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+	if !key.allows(token.Method.Alg()) {
+		return nil, ErrAlgorithmMismatch
+	}
+	return key.Public, nil
+}
+
+func parseError(err error) error {
+	ve, ok := err.(*jwt.ValidationError)
+	if !ok {
+		return err
+	}
+	switch {
+	case ve.Errors&jwt.ValidationErrorUnverifiable != 0 && ve.Inner != nil:
+		return ve.Inner
+	case ve.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+		return ErrSignatureInvalid
+	}
+	return ErrTokenMalformed
+}
+
+func (f JWTFactory) validateClaims(claims jwt.MapClaims, now time.Time) error {
+	exp, ok := numericClaim(claims, "exp")
+	if !ok {
+		return ErrMissingExpiration
+	}
+	if now.After(exp.Add(f.leeway)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(f.leeway).Before(nbf) {
+		return ErrTokenNotValidYet
+	}
+	if iat, ok := numericClaim(claims, "iat"); ok && now.Add(f.leeway).Before(iat) {
+		return ErrTokenNotValidYet
+	}
+	if f.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != f.issuer {
+			return ErrInvalidIssuer
+		}
+	}
+	if len(f.audience) > 0 && !f.acceptsAudience(claims["aud"]) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+// acceptsAudience reports whether aud, a string or a list of them, names one
+// of the configured audiences.
+func (f JWTFactory) acceptsAudience(aud interface{}) bool {
+	var values []string
+	switch v := aud.(type) {
+	case string:
+		values = []string{v}
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	for _, value := range values {
+		for _, expected := range f.audience {
+			if value == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stamp sets the registered claims of a token issued at now.
+func (f JWTFactory) stamp(claims jwt.MapClaims, now time.Time, timeout time.Duration) {
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(timeout).Unix()
+	if f.issuer != "" {
+		claims["iss"] = f.issuer
+	}
+	switch len(f.audience) {
+	case 0:
+	case 1:
+		claims["aud"] = f.audience[0]
+	default:
+		claims["aud"] = f.audience
+	}
+}
+
+func numericClaim(claims jwt.MapClaims, name string) (time.Time, bool) {
+	switch v := claims[name].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case int64:
+		return time.Unix(v, 0), true
+	case json.Number:
+		n, err := v.Int64()
+		return time.Unix(n, 0), err == nil
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,90 @@
+package xjwt
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTFactory_Validate(t *testing.T) {
+	assert := require.New(t)
+	f, err := NewJWTFactory(Config{
+		SingingAlgorithm: "HS256",
+		Key:              "secret",
+		Issuer:           "auth",
+		Audience:         []string{"api", "admin"},
+		Leeway:           "30s",
+	}, WithLoginFunc(login))
+	assert.NoError(err)
+
+	token, err := f.GenerateTokenWithClaims(jwt.MapClaims{"id": 1})
+	assert.NoError(err)
+	claims, err := f.GetClaims(token)
+	assert.NoError(err)
+	assert.Equal("auth", claims["iss"])
+	assert.Equal([]interface{}{"api", "admin"}, claims["aud"])
+	assert.Equal(claims["iat"], claims["nbf"])
+
+	now := time.Now()
+	for name, c := range map[string]struct {
+		claims jwt.MapClaims
+		err    error
+	}{
+		"within leeway":  {jwt.MapClaims{"iss": "auth", "aud": "api", "exp": now.Add(-10 * time.Second).Unix()}, nil},
+		"expired":        {jwt.MapClaims{"iss": "auth", "aud": "api", "exp": now.Add(-time.Minute).Unix()}, ErrTokenExpired},
+		"no exp":         {jwt.MapClaims{"iss": "auth", "aud": "api"}, ErrMissingExpiration},
+		"not yet valid":  {jwt.MapClaims{"iss": "auth", "aud": "api", "exp": now.Add(time.Hour).Unix(), "nbf": now.Add(time.Minute).Unix()}, ErrTokenNotValidYet},
+		"issued later":   {jwt.MapClaims{"iss": "auth", "aud": "api", "exp": now.Add(time.Hour).Unix(), "iat": now.Add(time.Minute).Unix()}, ErrTokenNotValidYet},
+		"wrong issuer":   {jwt.MapClaims{"iss": "other", "aud": "api", "exp": now.Add(time.Hour).Unix()}, ErrInvalidIssuer},
+		"wrong audience": {jwt.MapClaims{"iss": "auth", "aud": []string{"web"}, "exp": now.Add(time.Hour).Unix()}, ErrInvalidAudience},
+	} {
+		token, err := f.sign(c.claims)
+		assert.NoError(err)
+		_, err = f.GetClaims(token)
+		assert.Equal(c.err, err, name)
+	}
+
+	other, err := NewJWTFactory(Config{SingingAlgorithm: "HS256", Key: "other"}, WithLoginFunc(login))
+	assert.NoError(err)
+	forged, err := other.GenerateTokenWithClaims(jwt.MapClaims{"iss": "auth", "aud": "api"})
+	assert.NoError(err)
+	_, err = f.GetClaims(forged)
+	assert.Equal(ErrSignatureInvalid, err)
+	assert.Equal("invalid_signature", ErrorReason(err))
+	_, err = f.GetClaims("not.a.token")
+	assert.Equal(ErrTokenMalformed, err)
+	assert.Equal("invalid_token", ErrorReason(err))
+	assert.Equal("token_expired", ErrorReason(ErrTokenExpired))
+}
+
+func TestJWTFactory_AlgorithmPinned(t *testing.T) {
+	assert := require.New(t)
+	f, err := NewJWTFactory(Config{SingingAlgorithm: "HS256", Key: "secret"}, WithLoginFunc(login))
+	assert.NoError(err)
+
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()}).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+	assert.NoError(err)
+	_, err = f.GetClaims(none)
+	assert.Equal(ErrAlgorithmMismatch, err)
+
+	hs512, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()}).
+		SignedString([]byte("secret"))
+	assert.NoError(err)
+	_, err = f.GetClaims(hs512)
+	assert.Equal(ErrAlgorithmMismatch, err)
+
+	// HS256 keyed with the public PEM against an RS256 factory
+	rs, err := NewJWTFactory(Config{SingingAlgorithm: "RS256", PublicKeyFile: "./testData/zq_mall_rsa_public_key.pem"})
+	assert.NoError(err)
+	pem, err := ioutil.ReadFile("./testData/zq_mall_rsa_public_key.pem")
+	assert.NoError(err)
+	confused, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()}).
+		SignedString(pem)
+	assert.NoError(err)
+	_, err = rs.GetClaims(confused)
+	assert.Equal(ErrAlgorithmMismatch, err)
+}
@@ -0,0 +1,85 @@
+package xlog
+
+import (
+	"bufio"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// defaultFlushInterval flushes the buffered logs when FileLogConfig.FlushInterval is not set.
+const defaultFlushInterval = time.Second
+
+// bufferedWriteSyncer keeps the writes in a buffer of size bytes, it is
+// flushed when full, every interval in the background and on Sync.
+type bufferedWriteSyncer struct {
+	mu      sync.Mutex
+	ws      zapcore.WriteSyncer
+	buf     *bufio.Writer
+	stop    chan struct{}
+	done    chan struct{}
+	stopped bool
+}
+
+func newBufferedWriteSyncer(ws zapcore.WriteSyncer, size int, interval time.Duration) *bufferedWriteSyncer {
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	b := &bufferedWriteSyncer{
+		ws:   ws,
+		buf:  bufio.NewWriterSize(ws, size),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go b.flushLoop(interval)
+	return b
+}
+
+func (b *bufferedWriteSyncer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stopped {
+		return b.ws.Write(p)
+	}
+	return b.buf.Write(p)
+}
+
+func (b *bufferedWriteSyncer) Sync() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.buf.Flush(); err != nil {
+		return err
+	}
+	return b.ws.Sync()
+}
+
+// Stop flushes the buffer and stops the background flush, later writes go to ws directly.
+func (b *bufferedWriteSyncer) Stop() error {
+	b.mu.Lock()
+	if b.stopped {
+		b.mu.Unlock()
+		return nil
+	}
+	b.stopped = true
+	b.mu.Unlock()
+	close(b.stop)
+	<-b.done
+	return b.Sync()
+}
+
+func (b *bufferedWriteSyncer) flushLoop(interval time.Duration) {
+	defer close(b.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.mu.Lock()
+			_ = b.buf.Flush()
+			b.mu.Unlock()
+		case <-b.stop:
+			return
+		}
+	}
+}
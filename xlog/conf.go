@@ -1,17 +1,21 @@
 package xlog
 
-import "go.uber.org/zap/zapcore"
+import (
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
 
 type Config struct {
 	// 业务服务名称，如果多个业务日志在ELK中聚合，此字段就有用了
 	ServiceName string `yaml:"serviceName"`
 	// 日志级别.
 	Level string `yaml:"level"`
-	// 日志级别字段开启颜色功能
+	// 日志级别字段开启颜色功能，只对输出到控制台的 plain 格式生效
 	LevelColor bool `yaml:"levelColor"`
 	// Log format. one of json or plain.
 	Format string `yaml:"format"`
-	// 是否输出到控制台.
+	// 是否输出到控制台(stdout)，未配置日志文件时总是输出到 stderr.
 	Stdout bool `yaml:"stdout"`
 	// File xlog config.
 	File FileLogConfig `yaml:"file"`
@@ -39,7 +43,7 @@ func (c *Config) level() zapcore.Level {
 type FileLogConfig struct {
 	// Filename 日志文件路径.
 	Filename string `yaml:"filename"`
-	// LogRotate Is xlog rotate enabled.
+	// LogRotate Is xlog rotate enabled, otherwise Filename is a plain appended file.
 	LogRotate bool `yaml:"logRotate"`
 	// MaxSize size for a single file, in MB.
 	MaxSize int `yaml:"maxSize"`
@@ -47,8 +51,14 @@ type FileLogConfig struct {
 	MaxAge int `yaml:"maxAge"`
 	// MaxBackups  number of old xlog files to retain.
 	MaxBackups int `yaml:"maxBackups"`
-	// BufSize  size of bufio.Writer
+	// Compress compress the rotated files with gzip.
+	Compress bool `yaml:"compress"`
+	// LocalTime use the local time in the rotated file names, default is UTC.
+	LocalTime bool `yaml:"localTime"`
+	// BufSize  size of bufio.Writer in bytes, the writes are buffered and flushed asynchronously when set.
 	BufSize int `yaml:"bufSize"`
+	// FlushInterval flush the buffer at this interval, default is 1s.
+	FlushInterval time.Duration `yaml:"flushInterval"`
 }
 
 type EncodeKeyConfig struct {
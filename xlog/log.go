@@ -1,59 +1,119 @@
 package xlog
 
 import (
+	"io"
 	"os"
+	"path/filepath"
 
-	"github.com/natefinch/lumberjack"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-//New new a zap.Logger
-func New(conf Config) (*zap.Logger, error) {
-	encoderConfig := getEncoderConfig(conf)
+// New new a zap.Logger, the returned func flushes and closes the log outputs,
+// call it before the process exits.
+func New(conf Config) (*zap.Logger, func(), error) {
 	if conf.ServiceName != "" {
 		serviceName = conf.ServiceName
 	}
 	if conf.InternalTraceId != "" {
 		internalTraceId = conf.InternalTraceId
 	}
-	// 设置日志输出格式
-	var encoder zapcore.Encoder
-	switch conf.Format {
-	case "json":
-		encoder = zapcore.NewJSONEncoder(encoderConfig)
-	default:
-		encoder = zapcore.NewConsoleEncoder(encoderConfig)
-	}
-
-	writeSyncer := make([]zapcore.WriteSyncer, 0, 2)
-	writeSyncer = append(writeSyncer, zapcore.AddSync(os.Stderr))
 
+	cores := make([]zapcore.Core, 0, 3)
+	closers := make([]func() error, 0, 1)
 	if conf.File.Filename != "" {
-		// 添加日志切割归档功能
-		hook := lumberjack.Logger{
-			Filename:   conf.File.Filename,   // 日志文件路径
-			MaxSize:    conf.File.MaxSize,    // 每个日志文件保存的最大尺寸 单位：M
-			MaxBackups: conf.File.MaxBackups, // 日志文件最多保存多少个备份
-			MaxAge:     conf.File.MaxAge,     // 文件最多保存多少天
-			Compress:   false,                // 是否压缩
+		writeSyncer, closeFile, err := newFileWriteSyncer(conf.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		closers = append(closers, closeFile)
+		cores = append(cores, zapcore.NewCore(newEncoder(conf, false), writeSyncer, conf.level()))
+	}
+	// 没有配置日志文件时总是输出到 stderr，避免日志丢失
+	if conf.Stdout || len(cores) == 0 {
+		console := os.Stderr
+		if conf.Stdout {
+			console = os.Stdout
 		}
-		writeSyncer = append(writeSyncer, zapcore.AddSync(&hook))
+		cores = append(cores, zapcore.NewCore(newEncoder(conf, conf.LevelColor), zapcore.Lock(console), conf.level()))
 	}
 
-	core := zapcore.NewCore(
-		encoder, // 编码器配置
-		zapcore.NewMultiWriteSyncer(writeSyncer...),
-		conf.level(), // 日志级别
-	)
+	// 配置了 SentryDSN 时 warn 级别以上的日志同时发送 sentry
+	if conf.SentryDSN != "" {
+		sentry, err := newSentryCore(conf.SentryDSN)
+		if err != nil {
+			for _, c := range closers {
+				_ = c()
+			}
+			return nil, nil, err
+		}
+		closers = append(closers, sentry.close)
+		cores = append(cores, sentry)
+	}
 
 	// 构造日志
-	logger := zap.New(core, zap.AddCaller(), zap.Development())
+	logger := zap.New(zapcore.NewTee(cores...), zap.AddCaller(), zap.Development())
 	logger = logger.Named(conf.ServiceName)
 
 	// 将自定义的logger替换为全局的logger
 	zap.ReplaceGlobals(logger)
-	return logger, nil
+	return logger, func() {
+		_ = logger.Sync()
+		for _, c := range closers {
+			_ = c()
+		}
+	}, nil
+}
+
+// newEncoder 设置日志输出格式，color 只对 plain 格式生效
+func newEncoder(conf Config, color bool) zapcore.Encoder {
+	encoderConfig := getEncoderConfig(conf)
+	switch conf.Format {
+	case "json":
+		return zapcore.NewJSONEncoder(encoderConfig)
+	default:
+		if color {
+			encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		}
+		return zapcore.NewConsoleEncoder(encoderConfig)
+	}
+}
+
+// newFileWriteSyncer 打开日志文件，LogRotate 开启时按 lumberjack 切割归档，BufSize 大于 0 时异步缓冲写入
+func newFileWriteSyncer(conf FileLogConfig) (zapcore.WriteSyncer, func() error, error) {
+	var file io.WriteCloser
+	if conf.LogRotate {
+		file = &lumberjack.Logger{
+			Filename:   conf.Filename,   // 日志文件路径
+			MaxSize:    conf.MaxSize,    // 每个日志文件保存的最大尺寸 单位：M
+			MaxBackups: conf.MaxBackups, // 日志文件最多保存多少个备份
+			MaxAge:     conf.MaxAge,     // 文件最多保存多少天
+			Compress:   conf.Compress,   // 是否压缩
+			LocalTime:  conf.LocalTime,  // 备份文件名是否使用本地时间
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(conf.Filename), 0755); err != nil {
+			return nil, nil, err
+		}
+		f, err := os.OpenFile(conf.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		file = f
+	}
+	writeSyncer := zapcore.AddSync(file)
+	if conf.BufSize <= 0 {
+		return zapcore.Lock(writeSyncer), file.Close, nil
+	}
+	buffered := newBufferedWriteSyncer(writeSyncer, conf.BufSize, conf.FlushInterval)
+	return buffered, func() error {
+		err := buffered.Stop()
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
 }
 
 func getEncoderConfig(conf Config) zapcore.EncoderConfig {
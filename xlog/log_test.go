@@ -2,12 +2,22 @@ package xlog
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
 func TestNew(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
 	conf := Config{
 		ServiceName: "xlog-test",
 		Level:       "info",
@@ -15,7 +25,7 @@ func TestNew(t *testing.T) {
 		Format:      "json",
 		Stdout:      true,
 		File: FileLogConfig{
-			Filename:   "test.log",
+			Filename:   filepath.Join(dir, "test.log"),
 			LogRotate:  true,
 			MaxSize:    20,
 			MaxAge:     20,
@@ -25,9 +35,81 @@ func TestNew(t *testing.T) {
 		EncodeKey: EncodeKeyConfig{},
 		SentryDSN: "",
 	}
-	_, err := New(conf)
+	_, closeLog, err := New(conf)
 	if err != nil {
 		t.Error("创建 ginzap.logger 失败")
 	}
+	defer closeLog()
 	zap.S().Error(fmt.Sprint("Info xlog ", 2), zap.String("level", `{"a":"4","b":"5"}`))
 }
+
+func TestNew_PlainFile(t *testing.T) {
+	assert := require.New(t)
+	dir, err := ioutil.TempDir("", "xlog")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "logs", "plain.log")
+	assert.NoError(os.MkdirAll(filepath.Dir(filename), 0755))
+	assert.NoError(ioutil.WriteFile(filename, []byte("kept\n"), 0644))
+
+	logger, closeLog, err := New(Config{Format: "plain", LevelColor: true, File: FileLogConfig{Filename: filename}})
+	assert.NoError(err)
+	logger.Info("appended")
+	closeLog()
+
+	data, err := ioutil.ReadFile(filename)
+	assert.NoError(err)
+	assert.Contains(string(data), "kept\n")
+	assert.Contains(string(data), "INFO")
+	assert.Contains(string(data), "appended")
+	// no color codes in the file
+	assert.NotContains(string(data), "\x1b[")
+}
+
+func TestNew_Buffered(t *testing.T) {
+	assert := require.New(t)
+	dir, err := ioutil.TempDir("", "xlog")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "buffered.log")
+
+	logger, closeLog, err := New(Config{File: FileLogConfig{
+		Filename:      filename,
+		LogRotate:     true,
+		Compress:      true,
+		LocalTime:     true,
+		BufSize:       4096,
+		FlushInterval: time.Hour,
+	}})
+	assert.NoError(err)
+	logger.Info("buffered")
+	data, _ := ioutil.ReadFile(filename)
+	assert.NotContains(string(data), "buffered")
+
+	closeLog()
+	data, err = ioutil.ReadFile(filename)
+	assert.NoError(err)
+	assert.Contains(string(data), "buffered")
+}
+
+func TestBufferedWriteSyncer_FlushInterval(t *testing.T) {
+	assert := require.New(t)
+	f, err := ioutil.TempFile("", "xlog")
+	assert.NoError(err)
+	defer os.Remove(f.Name())
+	b := newBufferedWriteSyncer(f, 4096, 10*time.Millisecond)
+	_, err = b.Write([]byte("flushed\n"))
+	assert.NoError(err)
+	assert.Eventually(func() bool {
+		data, _ := ioutil.ReadFile(f.Name())
+		return string(data) == "flushed\n"
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(b.Stop())
+	assert.NoError(b.Stop())
+	_, err = b.Write([]byte("direct\n"))
+	assert.NoError(err)
+	data, _ := ioutil.ReadFile(f.Name())
+	assert.Equal("flushed\ndirect\n", string(data))
+	assert.NoError(f.Close())
+}
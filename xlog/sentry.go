@@ -0,0 +1,525 @@
+package xlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/donech/tool/xtrace"
+)
+
+var (
+	// sentryQueueSize events waiting to be sent, more are dropped.
+	sentryQueueSize = 256
+	// sentryDedupWindow an entry repeating within the window is sent once.
+	sentryDedupWindow = time.Minute
+	// sentryFlushTimeout how long Sync waits for queued events.
+	sentryFlushTimeout = 5 * time.Second
+	sentryTimeout      = 5 * time.Second
+)
+
+var sentryLevels = map[zapcore.Level]string{
+	zapcore.WarnLevel:   "warning",
+	zapcore.ErrorLevel:  "error",
+	zapcore.DPanicLevel: "fatal",
+	zapcore.PanicLevel:  "fatal",
+	zapcore.FatalLevel:  "fatal",
+}
+
+// sensitiveHeaders are dropped from the request of an event.
+var sensitiveHeaders = map[string]bool{"Authorization": true, "Cookie": true, "X-Api-Key": true}
+
+// sensitiveParams are query parameters whose values are filtered, matched
+// as substrings of the lowercased name, e.g. token, access_token, client_secret.
+var sensitiveParams = []string{"token", "secret", "password", "key"}
+
+const filtered = "[Filtered]"
+
+type sentryDSN struct {
+	endpoint string
+	auth     string
+	raw      string
+}
+
+// parseSentryDSN parses {scheme}://{key}[:{secret}]@{host}[/{path}]/{project}.
+func parseSentryDSN(dsn string) (sentryDSN, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return sentryDSN{}, fmt.Errorf("xlog: invalid sentry dsn: %w", err)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return sentryDSN{}, errors.New("xlog: sentry dsn has no public key")
+	}
+	i := strings.LastIndex(u.Path, "/")
+	project := u.Path[i+1:]
+	if project == "" {
+		return sentryDSN{}, errors.New("xlog: sentry dsn has no project id")
+	}
+	auth := "Sentry sentry_version=7, sentry_client=donech-xlog/1.0, sentry_key=" + u.User.Username()
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+	return sentryDSN{
+		endpoint: u.Scheme + "://" + u.Host + u.Path[:i] + "/api/" + project + "/envelope/",
+		auth:     auth,
+		raw:      dsn,
+	}, nil
+}
+
+type sentryItem struct {
+	event   []byte
+	flushed chan struct{}
+}
+
+type sentryDedup struct {
+	last       time.Time
+	suppressed int
+}
+
+// sentryTransport sends events in the background, in order.
+type sentryTransport struct {
+	dsn     sentryDSN
+	client  *http.Client
+	queue   chan sentryItem
+	dropped int64
+	closed  chan struct{}
+	once    sync.Once
+	// done is closed when run returns.
+	done chan struct{}
+
+	mu   sync.Mutex
+	seen map[string]*sentryDedup
+	now  func() time.Time
+}
+
+func newSentryTransport(dsn string) (*sentryTransport, error) {
+	d, err := parseSentryDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	t := &sentryTransport{
+		dsn:    d,
+		client: &http.Client{Timeout: sentryTimeout},
+		queue:  make(chan sentryItem, sentryQueueSize),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+		seen:   map[string]*sentryDedup{},
+		now:    time.Now,
+	}
+	go t.run()
+	return t, nil
+}
+
+func (t *sentryTransport) run() {
+	defer close(t.done)
+	for {
+		select {
+		case item := <-t.queue:
+			if item.flushed != nil {
+				close(item.flushed)
+				continue
+			}
+			t.send(item.event)
+		case <-t.closed:
+			return
+		}
+	}
+}
+
+func (t *sentryTransport) send(event []byte) {
+	var id struct {
+		EventID string `json:"event_id"`
+	}
+	_ = json.Unmarshal(event, &id)
+	header, _ := json.Marshal(map[string]string{"event_id": id.EventID, "dsn": t.dsn.raw, "sent_at": t.now().UTC().Format(time.RFC3339)})
+	body := bytes.NewBuffer(header)
+	body.WriteString("\n{\"type\":\"event\",\"length\":" + strconv.Itoa(len(event)) + "}\n")
+	body.Write(event)
+	body.WriteString("\n")
+	req, err := http.NewRequest(http.MethodPost, t.dsn.endpoint, body)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", t.dsn.auth)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "xlog: send sentry event error: %s\n", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		fmt.Fprintf(os.Stderr, "xlog: send sentry event error: status %d\n", resp.StatusCode)
+	}
+}
+
+// admit reports whether an entry of fingerprint may be sent now, and how many
+// were suppressed since the last one sent.
+func (t *sentryTransport) admit(fingerprint string) (bool, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	d, ok := t.seen[fingerprint]
+	if ok && now.Sub(d.last) < sentryDedupWindow {
+		d.suppressed++
+		return false, 0
+	}
+	if len(t.seen) >= sentryQueueSize*4 {
+		for k, v := range t.seen {
+			if now.Sub(v.last) >= sentryDedupWindow {
+				delete(t.seen, k)
+			}
+		}
+	}
+	suppressed := 0
+	if ok {
+		suppressed = d.suppressed
+	}
+	t.seen[fingerprint] = &sentryDedup{last: now}
+	return true, suppressed
+}
+
+func (t *sentryTransport) enqueue(event []byte) {
+	select {
+	case <-t.closed:
+		atomic.AddInt64(&t.dropped, 1)
+		return
+	default:
+	}
+	select {
+	case t.queue <- sentryItem{event: event}:
+	default:
+		atomic.AddInt64(&t.dropped, 1)
+	}
+}
+
+// flush waits until the events queued so far are sent.
+func (t *sentryTransport) flush() error {
+	select {
+	case <-t.closed:
+		return nil
+	default:
+	}
+	timer := time.NewTimer(sentryFlushTimeout)
+	defer timer.Stop()
+	flushed := make(chan struct{})
+	select {
+	case t.queue <- sentryItem{flushed: flushed}:
+	case <-timer.C:
+		return errors.New("xlog: sentry flush timeout")
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-timer.C:
+		return errors.New("xlog: sentry flush timeout")
+	}
+}
+
+// close flushes the queued events and stops the background sender, later
+// events are dropped.
+func (t *sentryTransport) close() error {
+	err := t.flush()
+	t.once.Do(func() {
+		close(t.closed)
+	})
+	<-t.done
+	return err
+}
+
+// sentryCore ships warn and above entries to Sentry, it is teed with the
+// core writing the logs.
+type sentryCore struct {
+	transport *sentryTransport
+	fields    []zapcore.Field
+}
+
+func newSentryCore(dsn string) (*sentryCore, error) {
+	t, err := newSentryTransport(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &sentryCore{transport: t}, nil
+}
+
+func (c *sentryCore) Enabled(level zapcore.Level) bool {
+	return level >= zapcore.WarnLevel
+}
+
+func (c *sentryCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &sentryCore{transport: c.transport, fields: make([]zapcore.Field, 0, len(c.fields)+len(fields))}
+	clone.fields = append(clone.fields, c.fields...)
+	clone.fields = append(clone.fields, fields...)
+	return clone
+}
+
+func (c *sentryCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *sentryCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	fingerprint := ent.Level.String() + "|" + ent.Message + "|" + ent.Caller.TrimmedPath()
+	ok, suppressed := c.transport.admit(fingerprint)
+	if !ok {
+		return nil
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	event := c.event(ent, enc.Fields)
+	if suppressed > 0 {
+		event["extra"].(map[string]interface{})["suppressed"] = suppressed
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	c.transport.enqueue(data)
+	if ent.Level > zapcore.ErrorLevel {
+		// the process is about to panic or exit
+		return c.transport.flush()
+	}
+	return nil
+}
+
+func (c *sentryCore) Sync() error {
+	return c.transport.flush()
+}
+
+func (c *sentryCore) close() error {
+	return c.transport.close()
+}
+
+func (c *sentryCore) event(ent zapcore.Entry, fields map[string]interface{}) map[string]interface{} {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	tags := map[string]string{}
+	extra := map[string]interface{}{}
+	event := map[string]interface{}{
+		"event_id":    hex.EncodeToString(id),
+		"timestamp":   ent.Time.UTC().Format(time.RFC3339Nano),
+		"platform":    "go",
+		"level":       sentryLevels[ent.Level],
+		"logger":      ent.LoggerName,
+		"message":     ent.Message,
+		"fingerprint": []string{ent.Level.String(), ent.Message, ent.Caller.TrimmedPath()},
+		"tags":        tags,
+		"extra":       extra,
+	}
+	if host, err := os.Hostname(); err == nil {
+		event["server_name"] = host
+	}
+	if ent.Caller.Defined {
+		event["culprit"] = ent.Caller.TrimmedPath()
+		tags["caller"] = ent.Caller.TrimmedPath()
+	}
+	stack := ent.Stack
+	for k, v := range fields {
+		switch k {
+		case string(xtrace.KeyName):
+			tags["trace_id"] = fmt.Sprint(v)
+		case serviceKey:
+			tags["service"] = fmt.Sprint(v)
+		case "method":
+			// the grpc panic recovery
+			tags["grpc.method"] = fmt.Sprint(v)
+			event["transaction"] = fmt.Sprint(v)
+		case "request":
+			// the gin panic recovery dumps the request
+			scheme, _ := fields["scheme"].(string)
+			if req := sentryRequest(fmt.Sprint(v), scheme); req != nil {
+				event["request"] = req
+				continue
+			}
+			extra[k] = v
+		case "stack":
+			stack = fmt.Sprint(v)
+		default:
+			extra[k] = v
+		}
+	}
+	frames := parseStack(stack)
+	if len(frames) == 0 {
+		frames = callerFrames()
+	}
+	exceptionType, value := "log."+ent.Level.CapitalString(), ent.Message
+	if _, ok := fields["stack"]; ok {
+		// the recoveries log the recovered value as error
+		exceptionType = "panic"
+	}
+	if e, ok := fields["error"]; ok {
+		value = fmt.Sprint(e)
+	}
+	event["exception"] = map[string]interface{}{
+		"values": []map[string]interface{}{{
+			"type":       exceptionType,
+			"value":      value,
+			"stacktrace": map[string]interface{}{"frames": frames},
+		}},
+	}
+	return event
+}
+
+// sentryRequest parses a request dumped by httputil.DumpRequest, the dump has
+// no scheme so it is taken from scheme, X-Forwarded-Proto, or else http.
+func sentryRequest(dump, scheme string) map[string]interface{} {
+	req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(dump)))
+	if err != nil {
+		return nil
+	}
+	headers := map[string]string{}
+	for k := range req.Header {
+		if !sensitiveHeaders[k] {
+			headers[k] = req.Header.Get(k)
+		}
+	}
+	if scheme == "" {
+		scheme = req.URL.Scheme
+	}
+	if scheme == "" {
+		scheme = strings.ToLower(strings.TrimSpace(strings.Split(req.Header.Get("X-Forwarded-Proto"), ",")[0]))
+	}
+	if scheme == "" {
+		scheme = "http"
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	return map[string]interface{}{
+		"method":       req.Method,
+		"url":          scheme + "://" + host + req.URL.Path,
+		"query_string": filterQuery(req.URL.Query()),
+		"headers":      headers,
+	}
+}
+
+// filterQuery returns the query pairs sorted by name, the values of
+// sensitiveParams are filtered.
+func filterQuery(query url.Values) [][2]string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([][2]string, 0, len(query))
+	for _, name := range names {
+		sensitive := false
+		lower := strings.ToLower(name)
+		for _, p := range sensitiveParams {
+			if strings.Contains(lower, p) {
+				sensitive = true
+				break
+			}
+		}
+		for _, v := range query[name] {
+			if sensitive {
+				v = filtered
+			}
+			pairs = append(pairs, [2]string{name, v})
+		}
+	}
+	return pairs
+}
+
+// parseStack turns a stack of zap or runtime/debug into sentry frames, the
+// outermost call first.
+func parseStack(stack string) []map[string]interface{} {
+	lines := strings.Split(strings.TrimSpace(stack), "\n")
+	frames := make([]map[string]interface{}, 0, len(lines)/2)
+	for i := 0; i+1 < len(lines); i++ {
+		location := lines[i+1]
+		if !strings.HasPrefix(location, "\t") {
+			continue
+		}
+		function := strings.TrimPrefix(lines[i], "created by ")
+		if j := strings.Index(function, " in goroutine "); j > 0 {
+			function = function[:j]
+		}
+		if j := strings.LastIndex(function, "("); j > 0 && strings.HasSuffix(function, ")") {
+			function = function[:j]
+		}
+		location = strings.TrimSpace(location)
+		if j := strings.LastIndex(location, " +0x"); j > 0 {
+			location = location[:j]
+		}
+		file, line := location, 0
+		if j := strings.LastIndex(location, ":"); j > 0 {
+			file = location[:j]
+			line, _ = strconv.Atoi(location[j+1:])
+		}
+		frames = append(frames, sentryFrame(function, file, line))
+		i++
+	}
+	return reverseFrames(frames)
+}
+
+// callerFrames captures the stack of the logging call, the frames up to the
+// last one of zap are dropped.
+func callerFrames() []map[string]interface{} {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(1, pcs)
+	iter := runtime.CallersFrames(pcs[:n])
+	frames := make([]map[string]interface{}, 0, n)
+	for {
+		f, more := iter.Next()
+		if strings.HasPrefix(f.Function, "go.uber.org/zap") {
+			frames = frames[:0]
+		} else {
+			frames = append(frames, sentryFrame(f.Function, f.File, f.Line))
+		}
+		if !more {
+			break
+		}
+	}
+	return reverseFrames(frames)
+}
+
+func sentryFrame(function, file string, line int) map[string]interface{} {
+	module := ""
+	if j := strings.LastIndex(function, "/"); j >= 0 {
+		if k := strings.Index(function[j:], "."); k >= 0 {
+			module, function = function[:j+k], function[j+k+1:]
+		}
+	} else if k := strings.Index(function, "."); k >= 0 {
+		module, function = function[:k], function[k+1:]
+	}
+	return map[string]interface{}{
+		"function": function,
+		"module":   module,
+		"abs_path": file,
+		"filename": file,
+		"lineno":   line,
+		"in_app":   !strings.Contains(file, "/pkg/mod/") && !strings.Contains(file, runtime.GOROOT()),
+	}
+}
+
+func reverseFrames(frames []map[string]interface{}) []map[string]interface{} {
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
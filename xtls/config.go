@@ -0,0 +1,23 @@
+package xtls
+
+import "time"
+
+type Config struct {
+	// CertFile PEM certificate chain presented to the peer.
+	CertFile string `yaml:"certFile"`
+	// KeyFile PEM private key of CertFile.
+	KeyFile string `yaml:"keyFile"`
+	// CAFile PEM CA bundle, servers verify client certificates with it and clients verify servers.
+	CAFile string `yaml:"caFile"`
+	// ClientAuth servers require and verify client certificates against CAFile.
+	ClientAuth bool `yaml:"clientAuth"`
+	// ServerName clients verify the server certificate against it, default the dialed host.
+	ServerName string `yaml:"serverName"`
+	// ReloadInterval how often files are checked for changes, default 1m, -1 disables reloading.
+	ReloadInterval time.Duration `yaml:"reloadInterval"`
+}
+
+// Enabled reports whether any certificate material is configured.
+func (c Config) Enabled() bool {
+	return c.CertFile != "" || c.CAFile != ""
+}
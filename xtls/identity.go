@@ -0,0 +1,55 @@
+package xtls
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+)
+
+const (
+	CtxIdentityKey KeyType = "tls-identity"
+)
+
+type KeyType string
+
+// Identity is the verified client certificate of a mutual TLS connection.
+type Identity struct {
+	CommonName   string
+	DNSNames     []string
+	URIs         []string
+	Emails       []string
+	SerialNumber string
+	Certificate  *x509.Certificate
+}
+
+func NewIdentity(cert *x509.Certificate) Identity {
+	uris := make([]string, 0, len(cert.URIs))
+	for _, u := range cert.URIs {
+		uris = append(uris, u.String())
+	}
+	return Identity{
+		CommonName:   cert.Subject.CommonName,
+		DNSNames:     cert.DNSNames,
+		URIs:         uris,
+		Emails:       cert.EmailAddresses,
+		SerialNumber: cert.SerialNumber.String(),
+		Certificate:  cert,
+	}
+}
+
+// IdentityFromRequest returns the verified client certificate of r.
+func IdentityFromRequest(r *http.Request) (Identity, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return Identity{}, false
+	}
+	return NewIdentity(r.TLS.VerifiedChains[0][0]), true
+}
+
+func SetIdentityToCtx(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, CtxIdentityKey, identity)
+}
+
+func GetIdentityFromCtx(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(CtxIdentityKey).(Identity)
+	return identity, ok
+}
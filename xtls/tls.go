@@ -0,0 +1,196 @@
+// Package xtls loads TLS certificates for the gin and xgrpc entries and
+// their clients, reloads them from disk, and carries the verified peer
+// identity in the context.
+package xtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/donech/tool/xlog"
+)
+
+var defaultReloadInterval = time.Minute
+
+var ErrNoCertificate = errors.New("xtls: certFile and keyFile are required")
+
+// NewReloader loads the files of conf and, unless ReloadInterval is -1,
+// checks them for changes in the background until Close is called.
+func NewReloader(conf Config) (*Reloader, error) {
+	if conf.ReloadInterval == 0 {
+		conf.ReloadInterval = defaultReloadInterval
+	}
+	r := &Reloader{conf: conf, stop: make(chan struct{})}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	if conf.ReloadInterval > 0 {
+		go r.watch()
+	}
+	return r, nil
+}
+
+// Reloader holds the current certificate and CA pool of a Config.
+type Reloader struct {
+	conf    Config
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime time.Time
+	stop    chan struct{}
+	once    sync.Once
+}
+
+func (r *Reloader) Close() {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+}
+
+// Certificate returns the current certificate, nil when no CertFile is configured.
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// Pool returns the current CA pool, nil when no CAFile is configured.
+func (r *Reloader) Pool() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pool
+}
+
+// ServerConfig returns a server tls.Config that picks up reloaded
+// certificates and CAs on every handshake.
+func (r *Reloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert := r.Certificate()
+			if cert == nil {
+				return nil, ErrNoCertificate
+			}
+			c := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				NextProtos:   []string{"h2", "http/1.1"},
+			}
+			if r.conf.ClientAuth {
+				c.ClientAuth = tls.RequireAndVerifyClientCert
+				c.ClientCAs = r.Pool()
+			}
+			return c, nil
+		},
+	}
+}
+
+// ClientConfig returns a client tls.Config that presents the reloaded
+// certificate, if any, and verifies servers against the CA pool current at
+// the time of the call. serverName is used when Config.ServerName is empty.
+func (r *Reloader) ClientConfig(serverName string) *tls.Config {
+	if r.conf.ServerName != "" {
+		serverName = r.conf.ServerName
+	}
+	c := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		RootCAs:    r.Pool(),
+	}
+	if r.Certificate() != nil {
+		c.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.Certificate(), nil
+		}
+	}
+	return c
+}
+
+// LoadClientConfig is a one-off ClientConfig for clients that are not worth a reloader.
+func LoadClientConfig(conf Config) (*tls.Config, error) {
+	conf.ReloadInterval = -1
+	r, err := NewReloader(conf)
+	if err != nil {
+		return nil, err
+	}
+	return r.ClientConfig(""), nil
+}
+
+func (r *Reloader) load() error {
+	var (
+		cert *tls.Certificate
+		pool *x509.CertPool
+	)
+	if r.conf.CertFile != "" || r.conf.KeyFile != "" {
+		if r.conf.CertFile == "" || r.conf.KeyFile == "" {
+			return ErrNoCertificate
+		}
+		c, err := tls.LoadX509KeyPair(r.conf.CertFile, r.conf.KeyFile)
+		if err != nil {
+			return err
+		}
+		if c.Leaf, err = x509.ParseCertificate(c.Certificate[0]); err != nil {
+			return err
+		}
+		cert = &c
+	}
+	if r.conf.CAFile != "" {
+		data, err := ioutil.ReadFile(r.conf.CAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("xtls: no certificate found in %s", r.conf.CAFile)
+		}
+	}
+	if r.conf.ClientAuth && pool == nil {
+		return errors.New("xtls: clientAuth requires caFile")
+	}
+	modTime := r.lastModified()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.pool, r.modTime = cert, pool, modTime
+	return nil
+}
+
+func (r *Reloader) lastModified() time.Time {
+	var last time.Time
+	for _, name := range []string{r.conf.CertFile, r.conf.KeyFile, r.conf.CAFile} {
+		if name == "" {
+			continue
+		}
+		if info, err := os.Stat(name); err == nil && info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last
+}
+
+func (r *Reloader) watch() {
+	ticker := time.NewTicker(r.conf.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.mu.RLock()
+			modTime := r.modTime
+			r.mu.RUnlock()
+			if !r.lastModified().After(modTime) {
+				continue
+			}
+			if err := r.load(); err != nil {
+				xlog.SS().Errorf("reload tls certificate error: %s", err)
+				continue
+			}
+			xlog.SS().Info("reload tls certificate success")
+		case <-r.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package xtls_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/donech/tool/xtls"
+	"github.com/donech/tool/xtls/xtlstest"
+)
+
+func TestReloader_MutualTLS(t *testing.T) {
+	assert := require.New(t)
+	dir, err := ioutil.TempDir("", "xtls")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	ca, err := xtlstest.NewCA(dir)
+	assert.NoError(err)
+	serverConf, err := ca.Issue(dir, "server", 2)
+	assert.NoError(err)
+	serverConf.ClientAuth = true
+	clientConf, err := ca.Issue(dir, "client", 3)
+	assert.NoError(err)
+
+	server, err := xtls.NewReloader(serverConf)
+	assert.NoError(err)
+	defer server.Close()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := xtls.IdentityFromRequest(r)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(identity.CommonName))
+	}))
+	srv.TLS = server.ServerConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	tlsConfig, err := xtls.LoadClientConfig(clientConf)
+	assert.NoError(err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := client.Get(srv.URL)
+	assert.NoError(err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal("client", string(body))
+
+	clientConf.CertFile, clientConf.KeyFile = "", ""
+	tlsConfig, err = xtls.LoadClientConfig(clientConf)
+	assert.NoError(err)
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	_, err = client.Get(srv.URL)
+	assert.Error(err)
+}
+
+func TestReloader_Reload(t *testing.T) {
+	assert := require.New(t)
+	dir, err := ioutil.TempDir("", "xtls")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	ca, err := xtlstest.NewCA(dir)
+	assert.NoError(err)
+	conf, err := ca.Issue(dir, "server", 2)
+	assert.NoError(err)
+	conf.ReloadInterval = 10 * time.Millisecond
+
+	r, err := xtls.NewReloader(conf)
+	assert.NoError(err)
+	defer r.Close()
+	assert.Equal(int64(2), r.Certificate().Leaf.SerialNumber.Int64())
+
+	_, err = ca.Issue(dir, "server", 4)
+	assert.NoError(err)
+	later := time.Now().Add(time.Minute)
+	assert.NoError(os.Chtimes(conf.CertFile, later, later))
+	assert.Eventually(func() bool {
+		return r.Certificate().Leaf.SerialNumber.Int64() == 4
+	}, time.Second, 10*time.Millisecond)
+
+	// a broken file keeps the last good certificate
+	assert.NoError(ioutil.WriteFile(conf.KeyFile, []byte("broken"), 0600))
+	later = later.Add(time.Minute)
+	assert.NoError(os.Chtimes(conf.KeyFile, later, later))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(int64(4), r.Certificate().Leaf.SerialNumber.Int64())
+}
+
+func TestConfig_Invalid(t *testing.T) {
+	assert := require.New(t)
+	_, err := xtls.NewReloader(xtls.Config{CertFile: "cert.pem"})
+	assert.Equal(xtls.ErrNoCertificate, err)
+	_, err = xtls.NewReloader(xtls.Config{ClientAuth: true})
+	assert.Error(err)
+	assert.False(xtls.Config{}.Enabled())
+
+	ctx := xtls.SetIdentityToCtx(context.Background(), xtls.Identity{CommonName: "svc"})
+	identity, ok := xtls.GetIdentityFromCtx(ctx)
+	assert.True(ok)
+	assert.Equal("svc", identity.CommonName)
+	_, ok = xtls.GetIdentityFromCtx(context.Background())
+	assert.False(ok)
+}
+
@@ -0,0 +1,98 @@
+// Package xtlstest writes throwaway certificates for tests.
+package xtlstest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/donech/tool/xtls"
+)
+
+// CA signs leaf certificates.
+type CA struct {
+	File string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// NewCA writes a self-signed CA certificate into dir.
+func NewCA(dir string) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "xtlstest ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	file := filepath.Join(dir, "ca.pem")
+	if err := writePEM(file, "CERTIFICATE", der); err != nil {
+		return nil, err
+	}
+	return &CA{File: file, cert: cert, key: key}, nil
+}
+
+// Issue writes a certificate for commonName, valid for both server and client
+// auth on localhost and 127.0.0.1, into dir and returns a Config using it.
+func (ca *CA) Issue(dir, commonName string, serial int64) (xtls.Config, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return xtls.Config{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return xtls.Config{}, err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return xtls.Config{}, err
+	}
+	conf := xtls.Config{
+		CertFile: filepath.Join(dir, commonName+".pem"),
+		KeyFile:  filepath.Join(dir, commonName+"-key.pem"),
+		CAFile:   ca.File,
+	}
+	if err := writePEM(conf.CertFile, "CERTIFICATE", der); err != nil {
+		return xtls.Config{}, err
+	}
+	if err := writePEM(conf.KeyFile, "EC PRIVATE KEY", keyDer); err != nil {
+		return xtls.Config{}, err
+	}
+	return conf, nil
+}
+
+func writePEM(file, typ string, der []byte) error {
+	return ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600)
+}